@@ -8,8 +8,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
 	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
-	models "github.com/bitrise-io/bitrise/models"
 	"github.com/bitrise-io/bitrise/plugins"
 	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/go-utils/pointers"
@@ -26,30 +26,15 @@ const (
 	workflowName     = "BITRISE_TRIGGERED_WORKFLOW_TITLE"
 	repoSlug         = "BITRISEIO_GIT_REPOSITORY_SLUG"
 	analyticsBaseURL = "https://bitrise-step-analytics.herokuapp.com"
-)
-
-func buildStatus(buildFailed bool) string {
-	return map[bool]string{false: "successful", true: "failed"}[buildFailed]
-}
 
-func stepStatus(i int) string {
-	if status, ok := map[int]string{
-		models.StepRunStatusCodeFailed:           "failed",
-		models.StepRunStatusCodeSuccess:          "success",
-		models.StepRunStatusCodeSkipped:          "skipped",
-		models.StepRunStatusCodeFailedSkippable:  "failed_skippable",
-		models.StepRunStatusCodeSkippedWithRunIf: "skipped_with_runif",
-	}[i]; ok {
-		return status
-	}
-	return "unknown"
-}
+	idempotencyKeyHeader = "Idempotency-Key"
+)
 
-// SendAnonymizedAnalytics ...
-func SendAnonymizedAnalytics(buildRunResults models.BuildRunResultsModel) error {
+// NewBuildAnalytics ...
+func NewBuildAnalytics(buildRunResults BuildRunResults) BuildAnalytics {
 	var (
 		runtime       time.Duration
-		stepAnalytics []analyticsModels.StepAnalytics
+		stepAnalytics []StepAnalytics
 	)
 
 	stepInputWhitelist := map[string]map[string]bool{
@@ -104,40 +89,60 @@ func SendAnonymizedAnalytics(buildRunResults models.BuildRunResultsModel) error
 			}
 		}
 
-		stepAnalytics, runtime = append(stepAnalytics, analyticsModels.StepAnalytics{
-			StepID:      stepResult.StepInfo.ID,
-			StepTitle:   pointers.StringWithDefault(stepResult.StepInfo.Step.Title, ""),
-			StepVersion: stepResult.StepInfo.Version,
-			StepSource:  pointers.StringWithDefault(stepResult.StepInfo.Step.SourceCodeURL, ""),
-			StepInputs:  filteredStepInputs,
-			Status:      stepStatus(stepResult.Status),
-			Runtime:     stepResult.RunTime,
-			StartTime:   stepResult.StartTime,
+		stepAnalytics, runtime = append(stepAnalytics, StepAnalytics{
+			StepAnalytics: analyticsModels.StepAnalytics{
+				StepID:      stepResult.StepInfo.ID,
+				StepTitle:   pointers.StringWithDefault(stepResult.StepInfo.Step.Title, ""),
+				StepVersion: stepResult.StepInfo.Version,
+				StepSource:  pointers.StringWithDefault(stepResult.StepInfo.Step.SourceCodeURL, ""),
+				StepInputs:  filteredStepInputs,
+				Status:      stepStatus(stepResult.Status),
+				Runtime:     stepResult.RunTime,
+				StartTime:   stepResult.StartTime,
+			},
+			Idx:        stepResult.Idx,
+			StatusCode: stepResult.Status,
 		}), runtime+stepResult.RunTime
 	}
 
-	var body bytes.Buffer
-	if err := json.NewEncoder(&body).Encode(analyticsModels.BuildAnalytics{
-		Runtime:       runtime,
-		StartTime:     buildRunResults.StartTime,
-		Platform:      buildRunResults.ProjectType,
-		StackID:       os.Getenv(stackIDEnvKey),
-		AppSlug:       os.Getenv(appSlugEnvKey),
-		BuildSlug:     os.Getenv(buildSlugEnvKey),
-		Status:        buildStatus(buildRunResults.IsBuildFailed()),
-		CLIVersion:    os.Getenv(plugins.PluginConfigBitriseVersionKey),
+	buildAnalytics := BuildAnalytics{
+		BuildAnalytics: analyticsModels.BuildAnalytics{
+			Runtime:      runtime,
+			StartTime:    buildRunResults.StartTime,
+			Platform:     buildRunResults.ProjectType,
+			StackID:      os.Getenv(stackIDEnvKey),
+			AppSlug:      os.Getenv(appSlugEnvKey),
+			BuildSlug:    os.Getenv(buildSlugEnvKey),
+			Status:       buildStatus(buildRunResults.BuildRunResultsModel),
+			CLIVersion:   os.Getenv(plugins.PluginConfigBitriseVersionKey),
+			RepositoryID: os.Getenv(repoSlug),
+			WorkflowName: os.Getenv(workflowName),
+		},
 		StepAnalytics: stepAnalytics,
-		RepositoryID:  os.Getenv(repoSlug),
-		WorkflowName:  os.Getenv(workflowName),
-	}); err != nil {
+		PayloadHash:   PayloadHash(buildRunResults.BuildRunResultsModel),
+	}
+	measureWallClock(&buildAnalytics)
+	return buildAnalytics
+}
+
+// SendAnonymizedAnalytics ...
+// If cloudEvents is configured, the build analytics is sent wrapped in a CloudEvents envelope.
+// The labels are only sent if sharing them is enabled in the config.
+func SendAnonymizedAnalytics(buildAnalytics BuildAnalytics, config configs.ConfigModel) error {
+	if !config.ShareLabels {
+		buildAnalytics.Labels = nil
+	}
+	cloudEvents := config.CloudEvents
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(buildAnalytics); err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, analyticsBaseURL+"/metrics", &body)
+	req, err := newAnalyticsRequest(buildAnalytics, body.Bytes(), cloudEvents)
 	if err != nil {
 		return fmt.Errorf("failed to create request with usage data (%s), error: %s", body.String(), err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	client := http.Client{
 		Timeout: time.Duration(10 * time.Second),
@@ -157,3 +162,32 @@ func SendAnonymizedAnalytics(buildRunResults models.BuildRunResultsModel) error
 	}
 	return nil
 }
+
+func newAnalyticsRequest(buildAnalytics BuildAnalytics, body []byte, cloudEvents *configs.CloudEventsConfigModel) (*http.Request, error) {
+	url := analyticsBaseURL + "/metrics"
+
+	var (
+		req *http.Request
+		err error
+	)
+	if cloudEvents != nil {
+		if cloudEvents.URL != "" {
+			url = cloudEvents.URL
+		}
+		submissionID := buildAnalytics.SubmissionID
+		if submissionID == "" {
+			submissionID = NewSubmissionID(buildAnalytics)
+		}
+		req, err = newCloudEventRequest(url, buildAnalytics, buildAnalytics.BuildSlug, submissionID, *cloudEvents)
+	} else if req, err = http.NewRequest(http.MethodPost, url, bytes.NewReader(body)); err == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if buildAnalytics.SubmissionID != "" {
+		req.Header.Set(idempotencyKeyHeader, buildAnalytics.SubmissionID)
+	}
+	return req, nil
+}
@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	bitriseConfigs "github.com/bitrise-io/bitrise/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// defaultArtifactTypes are used if no artifact types are configured.
+var defaultArtifactTypes = map[string][]string{
+	"apk":  {"*.apk"},
+	"aab":  {"*.aab"},
+	"ipa":  {"*.ipa"},
+	"dsym": {"*.dSYM.zip"},
+}
+
+// ArtifactSizes are the sizes of a type of artifacts in the deploy dir, no file names are collected.
+// TotalSizeDelta is the change of the total size since the previous build of the same workflow,
+// it is only set if that build is in the local history.
+type ArtifactSizes struct {
+	Count          int    `json:"count"`
+	TotalSize      int64  `json:"total_size"`
+	LargestSize    int64  `json:"largest_size"`
+	TotalSizeDelta *int64 `json:"total_size_delta,omitempty"`
+}
+
+// matchArtifactPattern matches patterns without a slash against the file name,
+// and patterns with a slash against the slash separated path relative to the deploy dir.
+func matchArtifactPattern(pattern, relPth string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		relPth = path.Base(relPth)
+	}
+	return path.Match(pattern, relPth)
+}
+
+// CollectArtifactSizes walks the deploy dir and returns the sizes of the artifacts by type.
+// A file matching the patterns of several types counts for each of them.
+func CollectArtifactSizes(deployDir string, artifactTypes map[string][]string) (map[string]ArtifactSizes, error) {
+	for artifactType, patterns := range artifactTypes {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern of artifact type %s (%s): %s", artifactType, pattern, err)
+			}
+		}
+	}
+
+	sizes := map[string]ArtifactSizes{}
+	err := filepath.Walk(deployDir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// directories and symlinks are not artifacts on their own
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPth, err := filepath.Rel(deployDir, pth)
+		if err != nil {
+			return err
+		}
+		relPth = filepath.ToSlash(relPth)
+
+		for artifactType, patterns := range artifactTypes {
+			for _, pattern := range patterns {
+				if match, _ := matchArtifactPattern(pattern, relPth); !match {
+					continue
+				}
+
+				typeSizes := sizes[artifactType]
+				typeSizes.Count++
+				typeSizes.TotalSize += info.Size()
+				if info.Size() > typeSizes.LargestSize {
+					typeSizes.LargestSize = info.Size()
+				}
+				sizes[artifactType] = typeSizes
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+// addArtifactSizeDeltas sets the total size deltas against the artifacts of the previous build.
+// Types the previous build had but the current one has not are added with a zero count.
+func addArtifactSizeDeltas(sizes, previous map[string]ArtifactSizes) {
+	for artifactType, previousSizes := range previous {
+		if _, ok := sizes[artifactType]; !ok && previousSizes.Count > 0 {
+			sizes[artifactType] = ArtifactSizes{}
+		}
+	}
+	for artifactType, typeSizes := range sizes {
+		delta := typeSizes.TotalSize - previous[artifactType].TotalSize
+		typeSizes.TotalSizeDelta = &delta
+		sizes[artifactType] = typeSizes
+	}
+}
+
+// previousArtifactSizes returns the artifact sizes of the last build of the workflow in the history.
+func previousArtifactSizes(history []BuildAnalytics, buildAnalytics BuildAnalytics) (map[string]ArtifactSizes, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		previous := history[i]
+		if previous.WorkflowName != buildAnalytics.WorkflowName || previous.AppSlug != buildAnalytics.AppSlug {
+			continue
+		}
+		if previous.BuildSlug != "" && previous.BuildSlug == buildAnalytics.BuildSlug {
+			continue
+		}
+		// builds recorded without artifact sizes have nothing to compare to
+		if previous.Artifacts == nil {
+			return nil, false
+		}
+		return previous.Artifacts, true
+	}
+	return nil, false
+}
+
+func enrichArtifacts(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	deployDir := os.Getenv(bitriseConfigs.BitriseDeployDirEnvKey)
+	if deployDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(deployDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	artifactTypes := config.Artifacts
+	if len(artifactTypes) == 0 {
+		artifactTypes = defaultArtifactTypes
+	}
+
+	sizes, err := CollectArtifactSizes(deployDir, artifactTypes)
+	if err != nil {
+		return err
+	}
+
+	history, err := ReadHistory()
+	if err != nil {
+		log.Debugf("Failed to read the local history, no artifact size deltas are collected: %s", err)
+	} else if previous, ok := previousArtifactSizes(history, *buildAnalytics); ok {
+		addArtifactSizeDeltas(sizes, previous)
+	}
+
+	buildAnalytics.Artifacts = sizes
+	return nil
+}
@@ -0,0 +1,90 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestCollectArtifactSizes(t *testing.T) {
+	deployDir, err := pathutil.NormalizedOSTempDirPath("deploy")
+	require.NoError(t, err)
+
+	writeFile := func(pth string, size int) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+		require.NoError(t, ioutil.WriteFile(pth, make([]byte, size), 0644))
+	}
+	writeFile(filepath.Join(deployDir, "app-debug.apk"), 10)
+	writeFile(filepath.Join(deployDir, "app-release.apk"), 30)
+	writeFile(filepath.Join(deployDir, "bundle", "app.aab"), 20)
+	writeFile(filepath.Join(deployDir, "logs", "build.log"), 5)
+
+	sizes, err := CollectArtifactSizes(deployDir, map[string][]string{
+		"android": {"*.apk", "*.aab"},
+		"apk":     {"*.apk"},
+		"logs":    {"logs/*"},
+		"ipa":     {"*.ipa"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]ArtifactSizes{
+		"android": {Count: 3, TotalSize: 60, LargestSize: 30},
+		"apk":     {Count: 2, TotalSize: 40, LargestSize: 30},
+		"logs":    {Count: 1, TotalSize: 5, LargestSize: 5},
+	}, sizes)
+
+	_, err = CollectArtifactSizes(deployDir, map[string][]string{"apk": {"[*.apk"}})
+	require.Error(t, err)
+}
+
+func TestEnrichArtifacts(t *testing.T) {
+	deployDir, err := pathutil.NormalizedOSTempDirPath("deploy")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(deployDir, "app.apk"), make([]byte, 100), 0644))
+
+	dataDir, err := pathutil.NormalizedOSTempDirPath("data")
+	require.NoError(t, err)
+	configs.DataDir = dataDir
+	require.NoError(t, os.Setenv("BITRISE_DEPLOY_DIR", deployDir))
+	defer func() {
+		configs.DataDir = ""
+		require.NoError(t, os.Unsetenv("BITRISE_DEPLOY_DIR"))
+	}()
+
+	newBuild := func(buildSlug, workflow string) BuildAnalytics {
+		return BuildAnalytics{BuildAnalytics: analyticsModels.BuildAnalytics{BuildSlug: buildSlug, WorkflowName: workflow}}
+	}
+
+	// no previous build
+	first := newBuild("build-1", "primary")
+	require.NoError(t, enrichArtifacts(&first, configs.ConfigModel{}))
+	require.Equal(t, map[string]ArtifactSizes{"apk": {Count: 1, TotalSize: 100, LargestSize: 100}}, first.Artifacts)
+
+	first.Artifacts["ipa"] = ArtifactSizes{Count: 1, TotalSize: 50, LargestSize: 50}
+	first.Artifacts["apk"] = ArtifactSizes{Count: 1, TotalSize: 80, LargestSize: 80}
+	require.NoError(t, AppendHistory(first))
+	other := newBuild("build-2", "deploy")
+	require.NoError(t, AppendHistory(other))
+
+	// deltas against the previous build of the same workflow
+	second := newBuild("build-3", "primary")
+	require.NoError(t, enrichArtifacts(&second, configs.ConfigModel{}))
+	require.Equal(t, map[string]ArtifactSizes{
+		"apk": {Count: 1, TotalSize: 100, LargestSize: 100, TotalSizeDelta: int64Ptr(20)},
+		"ipa": {TotalSizeDelta: int64Ptr(-50)},
+	}, second.Artifacts)
+
+	// the previous build of the workflow has no artifact sizes
+	third := newBuild("build-4", "deploy")
+	require.NoError(t, enrichArtifacts(&third, configs.ConfigModel{}))
+	require.Equal(t, map[string]ArtifactSizes{"apk": {Count: 1, TotalSize: 100, LargestSize: 100}}, third.Artifacts)
+}
@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/bitrise-plugins-analytics/version"
+)
+
+// CloudEvents content modes
+const (
+	CloudEventsModeStructured = "structured"
+	CloudEventsModeBinary     = "binary"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsTypePrefix  = "io.bitrise.analytics."
+	cloudEventsSource      = "bitrise-plugins-analytics/" + version.VERSION
+)
+
+// Trackable is implemented by the analytics models sent as events:
+// BuildAnalytics, StepAnalytics and RemoteLog.
+type Trackable interface {
+	Event() string
+	Model() interface{}
+}
+
+// CloudEvent is a CloudEvents 1.0 envelope in the structured JSON format.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewCloudEvent wraps the event of the build with the submission ID, the subject is the build slug.
+func NewCloudEvent(event Trackable, subject, submissionID string) (CloudEvent, error) {
+	data, err := json.Marshal(event.Model())
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	eventType := cloudEventsTypePrefix + event.Event()
+
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              cloudEventID(event, submissionID),
+		Source:          cloudEventsSource,
+		Type:            eventType,
+		Subject:         subject,
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
+
+// cloudEventID identifies the event by the build's submission ID, the event type and the step's idx for step events,
+// so every retry of the event has the same id, even if the event's content changes between the retries.
+func cloudEventID(event Trackable, submissionID string) string {
+	id := submissionID + "/" + event.Event()
+	if step, ok := event.(StepAnalytics); ok {
+		id += "/" + strconv.Itoa(step.Idx)
+	}
+	return id
+}
+
+// newCloudEventRequest creates the request delivering the event in the configured content mode:
+// the whole envelope as the body in structured mode, the data as the body
+// and the attributes as ce- headers in binary mode.
+func newCloudEventRequest(url string, event Trackable, subject, submissionID string, config configs.CloudEventsConfigModel) (*http.Request, error) {
+	cloudEvent, err := NewCloudEvent(event, subject, submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Mode {
+	case "", CloudEventsModeStructured:
+		body, err := json.Marshal(cloudEvent)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+		return req, nil
+	case CloudEventsModeBinary:
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(cloudEvent.Data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", cloudEvent.DataContentType)
+		req.Header.Set("ce-specversion", cloudEvent.SpecVersion)
+		req.Header.Set("ce-id", cloudEvent.ID)
+		req.Header.Set("ce-source", cloudEvent.Source)
+		req.Header.Set("ce-type", cloudEvent.Type)
+		if cloudEvent.Subject != "" {
+			req.Header.Set("ce-subject", cloudEvent.Subject)
+		}
+		return req, nil
+	default:
+		return nil, fmt.Errorf("unknown cloudevents mode: %s (options: %s, %s)", config.Mode, CloudEventsModeStructured, CloudEventsModeBinary)
+	}
+}
@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/bitrise-plugins-analytics/version"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCloudEvent(t *testing.T) {
+	remoteLog := analyticsModels.RemoteLog{LogLevel: "error", Message: "failed", Data: map[string]interface{}{"step_id": "script"}}
+
+	first, err := NewCloudEvent(remoteLog, "build-slug", "submission-id")
+	require.NoError(t, err)
+	remoteLog.Message = "failed again"
+	retry, err := NewCloudEvent(remoteLog, "build-slug", "submission-id")
+	require.NoError(t, err)
+
+	require.Equal(t, "submission-id/remote_log", first.ID)
+	require.Equal(t, first.ID, retry.ID, "id should be stable across retries")
+	require.Equal(t, "1.0", first.SpecVersion)
+	require.Equal(t, "io.bitrise.analytics.remote_log", first.Type)
+	require.Equal(t, "bitrise-plugins-analytics/"+version.VERSION, first.Source)
+	require.Equal(t, "build-slug", first.Subject)
+
+	step, err := NewCloudEvent(testBuildAnalytics.StepAnalytics[1], "build-slug", "submission-id")
+	require.NoError(t, err)
+	require.Equal(t, "io.bitrise.analytics.step_finished", step.Type)
+	require.Equal(t, "submission-id/step_finished/1", step.ID)
+
+	build, err := NewCloudEvent(testBuildAnalytics, "build-slug", "other-submission-id")
+	require.NoError(t, err)
+	require.Equal(t, "other-submission-id/build_finished", build.ID)
+}
+
+func Test_newCloudEventRequest(t *testing.T) {
+	t.Log("structured mode")
+	{
+		req, err := newCloudEventRequest("http://localhost/events", testBuildAnalytics, "build-slug", "submission-id", configs.CloudEventsConfigModel{})
+		require.NoError(t, err)
+		require.Equal(t, "application/cloudevents+json; charset=utf-8", req.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		var envelope CloudEvent
+		require.NoError(t, json.Unmarshal(body, &envelope))
+		require.Equal(t, "io.bitrise.analytics.build_finished", envelope.Type)
+
+		var data BuildAnalytics
+		require.NoError(t, json.Unmarshal(envelope.Data, &data))
+		require.Equal(t, testBuildAnalytics, data)
+	}
+
+	t.Log("binary mode")
+	{
+		req, err := newCloudEventRequest("http://localhost/events", testBuildAnalytics, "build-slug", "submission-id", configs.CloudEventsConfigModel{Mode: CloudEventsModeBinary})
+		require.NoError(t, err)
+		require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		require.Equal(t, "1.0", req.Header.Get("ce-specversion"))
+		require.Equal(t, "io.bitrise.analytics.build_finished", req.Header.Get("ce-type"))
+		require.Equal(t, "build-slug", req.Header.Get("ce-subject"))
+		require.Equal(t, "submission-id/build_finished", req.Header.Get("ce-id"))
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		var data BuildAnalytics
+		require.NoError(t, json.Unmarshal(body, &data))
+		require.Equal(t, testBuildAnalytics, data)
+	}
+
+	t.Log("unknown mode")
+	{
+		_, err := newCloudEventRequest("http://localhost/events", testBuildAnalytics, "build-slug", "submission-id", configs.CloudEventsConfigModel{Mode: "batched"})
+		require.Error(t, err)
+	}
+}
+
+func TestSendAnonymizedAnalyticsLabels(t *testing.T) {
+	var received []BuildAnalytics
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Data BuildAnalytics `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event.Data)
+	}))
+	defer server.Close()
+
+	buildAnalytics := testBuildAnalytics
+	buildAnalytics.Labels = map[string]string{"team": "mobile"}
+	buildAnalytics.Pipeline = &PipelineContext{PipelineID: "pipeline", PipelineTitle: "Release"}
+	buildAnalytics.TriggerContext = &TriggerContext{TriggerType: TriggerTypePush, BranchHash: "hash"}
+
+	config := configs.ConfigModel{CloudEvents: &configs.CloudEventsConfigModel{URL: server.URL}}
+	require.NoError(t, SendAnonymizedAnalytics(buildAnalytics, config))
+
+	config.ShareLabels = true
+	require.NoError(t, SendAnonymizedAnalytics(buildAnalytics, config))
+
+	require.Len(t, received, 2)
+	require.Nil(t, received[0].Labels)
+	require.Equal(t, buildAnalytics.Pipeline, received[0].Pipeline)
+	require.Equal(t, buildAnalytics.TriggerContext, received[0].TriggerContext)
+	require.Equal(t, buildAnalytics.Labels, received[1].Labels)
+
+	// the build analytics is not modified
+	require.NotNil(t, buildAnalytics.Labels)
+}
@@ -0,0 +1,260 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	defaultElasticsearchBuildIndex = "bitrise-builds-{now/d}"
+	defaultElasticsearchStepIndex  = "bitrise-steps-{now/d}"
+)
+
+// ElasticsearchSink indexes one document per build and one per step through the _bulk API.
+// Document IDs are derived from the build slug and the step index,
+// so re-sending a build overwrites its documents instead of duplicating them.
+type ElasticsearchSink struct {
+	config configs.ElasticsearchConfigModel
+}
+
+// NewElasticsearchSink ...
+func NewElasticsearchSink(config configs.ElasticsearchConfigModel) ElasticsearchSink {
+	if config.BuildIndex == "" {
+		config.BuildIndex = defaultElasticsearchBuildIndex
+	}
+	if config.StepIndex == "" {
+		config.StepIndex = defaultElasticsearchStepIndex
+	}
+	return ElasticsearchSink{config: config}
+}
+
+// Name ...
+func (s ElasticsearchSink) Name() string {
+	return "elasticsearch"
+}
+
+type esBulkAction struct {
+	Index esBulkActionMeta `json:"index"`
+}
+
+type esBulkActionMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+type esStepDocument struct {
+	StepAnalytics
+
+	Timestamp    time.Time `json:"@timestamp"`
+	StepIndex    int       `json:"step_index"`
+	AppSlug      string    `json:"app_slug"`
+	BuildSlug    string    `json:"build_slug"`
+	StackID      string    `json:"stack_id"`
+	Platform     string    `json:"platform"`
+	WorkflowName string    `json:"workflow_name"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type esBulkResponse struct {
+	Errors bool                            `json:"errors"`
+	Items  []map[string]esBulkResponseItem `json:"items"`
+}
+
+type esBulkResponseItem struct {
+	Index  string `json:"_index"`
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// Send ...
+func (s ElasticsearchSink) Send(buildAnalytics BuildAnalytics) error {
+	if s.config.URL == "" {
+		return errors.New("url is not configured")
+	}
+
+	body, err := s.bulkBody(buildAnalytics)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.config.URL, "/")+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create bulk request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.config.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.config.APIKey)
+	} else if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	client := http.Client{
+		Timeout: time.Duration(10 * time.Second),
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform bulk request: %s", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Errorf("failed to close response body, error: %#v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bulk request failed with status code: %d", resp.StatusCode)
+	}
+
+	var bulkResp esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bulkResp); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %s", err)
+	}
+	return bulkResp.err()
+}
+
+func (r esBulkResponse) err() error {
+	if !r.Errors {
+		return nil
+	}
+
+	var failed []string
+	for _, item := range r.Items {
+		for action, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			log.Debugf("Failed to %s document %s/%s (status: %d): %s: %s", action, result.Index, result.ID, result.Status, result.Error.Type, result.Error.Reason)
+			failed = append(failed, fmt.Sprintf("%s/%s: %s", result.Index, result.ID, result.Error.Type))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d documents failed to index: %s", len(failed), len(r.Items), strings.Join(failed, ", "))
+}
+
+func (s ElasticsearchSink) bulkBody(buildAnalytics BuildAnalytics) ([]byte, error) {
+	buildIndex, err := resolveIndexName(s.config.BuildIndex, buildAnalytics.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	stepIndex, err := resolveIndexName(s.config.StepIndex, buildAnalytics.StartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	buildDocument, err := esBuildDocument(buildAnalytics)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	if err := enc.Encode(esBulkAction{esBulkActionMeta{Index: buildIndex, ID: buildAnalytics.BuildSlug}}); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(buildDocument); err != nil {
+		return nil, err
+	}
+
+	for _, step := range buildAnalytics.StepAnalytics {
+		var id string
+		if buildAnalytics.BuildSlug != "" {
+			id = buildAnalytics.BuildSlug + "-" + strconv.Itoa(step.Idx)
+		}
+
+		timestamp := step.StartTime
+		if timestamp.IsZero() {
+			timestamp = buildAnalytics.StartTime
+		}
+
+		if err := enc.Encode(esBulkAction{esBulkActionMeta{Index: stepIndex, ID: id}}); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(esStepDocument{
+			StepAnalytics: step,
+			Timestamp:     timestamp,
+			StepIndex:     step.Idx,
+			AppSlug:       buildAnalytics.AppSlug,
+			BuildSlug:     buildAnalytics.BuildSlug,
+			StackID:       buildAnalytics.StackID,
+			Platform:      buildAnalytics.Platform,
+			WorkflowName:  buildAnalytics.WorkflowName,
+			Labels:        buildAnalytics.Labels,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// esBuildDocument returns the build analytics without the step analytics,
+// which are indexed as separate documents.
+func esBuildDocument(buildAnalytics BuildAnalytics) (map[string]interface{}, error) {
+	b, err := json.Marshal(buildAnalytics)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(b, &document); err != nil {
+		return nil, err
+	}
+	delete(document, "step_analytics")
+	document["step_count"] = len(buildAnalytics.StepAnalytics)
+	document["@timestamp"] = buildAnalytics.StartTime
+	return document, nil
+}
+
+var indexDateMathPattern = regexp.MustCompile(`\{now(?:/([yMd]))?(?:\{([^}]*)\})?\}`)
+
+var jodaToGoLayout = strings.NewReplacer("yyyy", "2006", "yy", "06", "MM", "01", "dd", "02")
+
+// resolveIndexName resolves the date math expressions of an index name
+// (like "{now/d}" or "{now/M{yyyy.MM}}") against the given time instead of the indexing time,
+// so re-sent documents end up in the same index.
+func resolveIndexName(name string, t time.Time) (string, error) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	t = t.UTC()
+
+	resolved := indexDateMathPattern.ReplaceAllStringFunc(name, func(expr string) string {
+		match := indexDateMathPattern.FindStringSubmatch(expr)
+		rounding, format := match[1], match[2]
+
+		rounded := t
+		switch rounding {
+		case "y":
+			rounded = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		case "M":
+			rounded = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+
+		if format == "" {
+			format = "yyyy.MM.dd"
+		}
+		return rounded.Format(jodaToGoLayout.Replace(format))
+	})
+	if strings.ContainsAny(resolved, "{}") {
+		return "", fmt.Errorf("unsupported date math expression in index name: %s", name)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_resolveIndexName(t *testing.T) {
+	buildStart := time.Date(2020, 3, 15, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		name    string
+		index   string
+		want    string
+		wantErr bool
+	}{
+		{name: "static name", index: "bitrise-builds", want: "bitrise-builds"},
+		{name: "daily index (UTC)", index: "bitrise-builds-{now/d}", want: "bitrise-builds-2020.03.15"},
+		{name: "monthly index with format", index: "bitrise-builds-{now/M{yyyy.MM}}", want: "bitrise-builds-2020.03"},
+		{name: "yearly rounding with default format", index: "builds-{now/y}", want: "builds-2020.01.01"},
+		{name: "unsupported expression", index: "builds-{now-1d}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveIndexName(tt.index, buildStart)
+			require.Equal(t, tt.wantErr, err != nil, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestElasticsearchSinkSend(t *testing.T) {
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/_bulk", r.URL.Path)
+		require.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		lines = strings.Split(strings.TrimSpace(string(body)), "\n")
+
+		_, err = w.Write([]byte(`{"errors":true,"items":[
+			{"index":{"_index":"builds","_id":"slug","status":201}},
+			{"index":{"_index":"steps","_id":"slug-0","status":201}},
+			{"index":{"_index":"steps","_id":"slug-1","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}
+		]}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	buildAnalytics := testBuildAnalytics
+	buildAnalytics.BuildSlug = "slug"
+
+	sink := NewElasticsearchSink(configs.ElasticsearchConfigModel{URL: server.URL, BuildIndex: "builds", StepIndex: "steps"})
+	err := sink.Send(buildAnalytics)
+	require.EqualError(t, err, "1 of 3 documents failed to index: steps/slug-1: mapper_parsing_exception")
+
+	require.Len(t, lines, 6)
+	require.Equal(t, `{"index":{"_index":"builds","_id":"slug"}}`, lines[0])
+	require.Equal(t, `{"index":{"_index":"steps","_id":"slug-1"}}`, lines[4])
+
+	var stepDocument map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[5]), &stepDocument))
+	require.Equal(t, "xcode-test", stepDocument["step_id"])
+	require.Equal(t, "slug", stepDocument["build_slug"])
+	require.Equal(t, float64(1), stepDocument["step_index"])
+
+	var buildDocument map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &buildDocument))
+	require.NotContains(t, buildDocument, "step_analytics")
+	require.Equal(t, float64(2), buildDocument["step_count"])
+}
+
+func TestElasticsearchStepDocumentIDs(t *testing.T) {
+	// a processor removed the first step
+	buildAnalytics := testBuildAnalytics
+	buildAnalytics.BuildSlug = "slug"
+	buildAnalytics.StepAnalytics = buildAnalytics.StepAnalytics[1:]
+
+	body, err := NewElasticsearchSink(configs.ElasticsearchConfigModel{BuildIndex: "builds", StepIndex: "steps"}).bulkBody(buildAnalytics)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, `{"index":{"_index":"steps","_id":"slug-1"}}`, lines[2])
+
+	var stepDocument map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &stepDocument))
+	require.Equal(t, float64(1), stepDocument["step_index"])
+}
@@ -0,0 +1,30 @@
+package analytics
+
+import (
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+type enrichmentStage struct {
+	name   string
+	enrich func(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error
+}
+
+var enrichmentStages = []enrichmentStage{
+	{name: "trigger context", enrich: enrichTriggerContext},
+	{name: "pipeline context", enrich: enrichPipelineContext},
+	{name: "labels", enrich: enrichLabels},
+	{name: "step metrics", enrich: enrichStepMetrics},
+	{name: "test results", enrich: enrichTestResults},
+	{name: "artifact sizes", enrich: enrichArtifacts},
+}
+
+// Enrich adds the data the plugin collects besides the build run results to the build analytics.
+// A failing stage is logged and skipped, it never fails the build.
+func Enrich(buildAnalytics *BuildAnalytics, config configs.ConfigModel) {
+	for _, stage := range enrichmentStages {
+		if err := stage.enrich(buildAnalytics, config); err != nil {
+			log.Warnf("Failed to collect %s: %s", stage.name, err)
+		}
+	}
+}
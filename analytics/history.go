@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const historyFileName = "history.jsonl"
+
+func historyFilePath() (string, error) {
+	if configs.DataDir == "" {
+		return "", errors.New("plugin data dir is not set")
+	}
+	return filepath.Join(configs.DataDir, historyFileName), nil
+}
+
+// AppendHistory records the build analytics in the plugin's local history.
+func AppendHistory(buildAnalytics BuildAnalytics) error {
+	pth, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(buildAnalytics)
+	if err != nil {
+		return err
+	}
+	return appendToFile(pth, append(record, '\n'))
+}
+
+// ReadHistory returns the builds recorded in the local history, in the order they were recorded.
+func ReadHistory() ([]BuildAnalytics, error) {
+	pth, err := historyFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(pth)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close history file: %s", err)
+		}
+	}()
+
+	var history []BuildAnalytics
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var buildAnalytics BuildAnalytics
+		if err := json.Unmarshal(scanner.Bytes(), &buildAnalytics); err != nil {
+			log.Debugf("Skipping invalid history record (line %d): %s", line, err)
+			continue
+		}
+		history = append(history, buildAnalytics)
+	}
+	return history, scanner.Err()
+}
+
+// HistoryFilter selects builds of the local history.
+type HistoryFilter struct {
+	Workflow string
+	Labels   map[string]string
+}
+
+// Match ...
+func (f HistoryFilter) Match(buildAnalytics BuildAnalytics) bool {
+	if f.Workflow != "" && f.Workflow != buildAnalytics.WorkflowName {
+		return false
+	}
+	for key, value := range f.Labels {
+		if buildAnalytics.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SameBuild tells whether the build analytics are of the same build: builds with slugs are identified by their slugs,
+// the others by their payload hash, or by their app, workflow, start time and runtime if it is not recorded.
+func SameBuild(a, b BuildAnalytics) bool {
+	switch {
+	case a.BuildSlug != "" || b.BuildSlug != "":
+		return a.BuildSlug == b.BuildSlug
+	case a.PayloadHash != "" && b.PayloadHash != "":
+		return a.PayloadHash == b.PayloadHash
+	}
+	return a.AppSlug == b.AppSlug &&
+		a.WorkflowName == b.WorkflowName &&
+		a.StartTime.Equal(b.StartTime) &&
+		a.Runtime == b.Runtime &&
+		len(a.StepAnalytics) == len(b.StepAnalytics)
+}
+
+// IsRecorded tells whether the build is recorded in the history.
+func IsRecorded(history []BuildAnalytics, buildAnalytics BuildAnalytics) bool {
+	for _, recorded := range history {
+		if SameBuild(recorded, buildAnalytics) {
+			return true
+		}
+	}
+	return false
+}
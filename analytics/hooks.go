@@ -0,0 +1,146 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// defaultHookTimeout applies to hooks and processors without a timeout.
+const defaultHookTimeout = time.Minute
+
+// HookResult ...
+type HookResult struct {
+	Name     string
+	ExitCode int
+	Stderr   string
+	Duration time.Duration
+	Err      error
+}
+
+// RunHooks runs the hooks with the build analytics JSON on their stdin and the build context in their envs,
+// at most concurrency of them at a time. The hooks' results are logged in the configured order.
+func RunHooks(hooks []configs.HookConfigModel, concurrency int, buildAnalytics BuildAnalytics) []HookResult {
+	if len(hooks) == 0 {
+		return nil
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	payload, err := json.Marshal(buildAnalytics)
+	if err != nil {
+		log.Warnf("Failed to encode hook payload: %s", err)
+		return nil
+	}
+	envs := append(os.Environ(), buildContextEnvs(buildAnalytics)...)
+
+	var (
+		results   = make([]HookResult, len(hooks))
+		wg        sync.WaitGroup
+		semaphore = make(chan bool, concurrency)
+	)
+	for i, hook := range hooks {
+		wg.Add(1)
+		semaphore <- true
+		go func(i int, hook configs.HookConfigModel) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i] = runHook(hook, payload, envs)
+		}(i, hook)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		logHookResult(result)
+	}
+	return results
+}
+
+func runHook(hook configs.HookConfigModel, payload []byte, envs []string) HookResult {
+	result := runCommand(hook.Command, hook.Args, hook.Timeout, payload, envs)
+	return HookResult{
+		Name:     hook.Name,
+		ExitCode: result.exitCode,
+		Stderr:   result.stderr,
+		Duration: result.duration,
+		Err:      result.err,
+	}
+}
+
+type commandResult struct {
+	stdout   []byte
+	stderr   string
+	exitCode int
+	duration time.Duration
+	err      error
+}
+
+// runCommand runs an external command with the given stdin, killing it after the timeout.
+func runCommand(name string, args []string, timeout time.Duration, stdin []byte, envs []string) commandResult {
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = envs
+
+	start := time.Now()
+	err := cmd.Run()
+
+	result := commandResult{
+		stdout:   stdout.Bytes(),
+		stderr:   strings.TrimSpace(stderr.String()),
+		duration: time.Since(start),
+		err:      err,
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		result.err = ctx.Err()
+	}
+	if cmd.ProcessState != nil {
+		result.exitCode = cmd.ProcessState.ExitCode()
+	}
+	return result
+}
+
+func logHookResult(result HookResult) {
+	if result.Err != nil {
+		log.Warnf("Hook %s failed after %s (exit code: %d): %s", result.Name, result.Duration.Round(time.Millisecond), result.ExitCode, result.Err)
+	} else {
+		log.Debugf("Hook %s finished in %s (exit code: %d)", result.Name, result.Duration.Round(time.Millisecond), result.ExitCode)
+	}
+
+	if result.Stderr != "" {
+		for _, line := range strings.Split(result.Stderr, "\n") {
+			log.Printf("[%s] %s", result.Name, line)
+		}
+	}
+}
+
+// buildContextEnvs returns the build's context for the external commands run by the plugin.
+func buildContextEnvs(buildAnalytics BuildAnalytics) []string {
+	return []string{
+		"BITRISE_ANALYTICS_APP_SLUG=" + buildAnalytics.AppSlug,
+		"BITRISE_ANALYTICS_BUILD_SLUG=" + buildAnalytics.BuildSlug,
+		"BITRISE_ANALYTICS_WORKFLOW=" + buildAnalytics.WorkflowName,
+		"BITRISE_ANALYTICS_STACK_ID=" + buildAnalytics.StackID,
+		"BITRISE_ANALYTICS_BUILD_STATUS=" + buildAnalytics.Status,
+		"BITRISE_ANALYTICS_DATA_DIR=" + configs.DataDir,
+	}
+}
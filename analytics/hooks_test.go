@@ -0,0 +1,47 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHooks(t *testing.T) {
+	hooks := []configs.HookConfigModel{
+		{
+			Name:    "payload",
+			Command: "sh",
+			Args:    []string{"-c", `grep -o '"workflow_name":"primary"' >&2 && echo "$BITRISE_ANALYTICS_BUILD_STATUS" >&2`},
+		},
+		{
+			Name:    "failing",
+			Command: "sh",
+			Args:    []string{"-c", "echo broken >&2; exit 3"},
+		},
+		{
+			Name:    "slow",
+			Command: "sleep",
+			Args:    []string{"10"},
+			Timeout: 100 * time.Millisecond,
+		},
+	}
+
+	start := time.Now()
+	results := RunHooks(hooks, 3, testBuildAnalytics)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	require.Len(t, results, 3)
+
+	require.NoError(t, results[0].Err)
+	require.Equal(t, 0, results[0].ExitCode)
+	require.Equal(t, "\"workflow_name\":\"primary\"\nfailed", results[0].Stderr)
+
+	require.Error(t, results[1].Err)
+	require.Equal(t, 3, results[1].ExitCode)
+	require.Equal(t, "broken", results[1].Stderr)
+
+	require.Error(t, results[2].Err)
+	require.Equal(t, "slow", results[2].Name)
+}
@@ -0,0 +1,238 @@
+package analytics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// InfluxDB measurements written by the InfluxDBSink.
+//
+// The build measurement holds one point per build, timestamped with the build's start time.
+// Tags: app_slug, repo_id, stack_id, platform, cli_version, workflow, status.
+// Fields: build_slug (string), run_time (integer, nanoseconds), step_count (integer).
+//
+// The step measurement holds one point per step, timestamped with the step's start time,
+// or the build's start time if the step's is unknown.
+// Tags: app_slug, stack_id, platform, workflow, step_id, step_version, status.
+// Fields: build_slug, step_title, step_source (strings), run_time (integer, nanoseconds)
+// and the step's custom metrics as metric_<name> (float).
+//
+// Both measurements are tagged with the build's labels as label_<key>.
+// Empty tags are omitted, as InfluxDB rejects tags without value.
+const (
+	influxBuildMeasurement = "build"
+	influxStepMeasurement  = "step"
+)
+
+// InfluxDBSink writes build and step analytics in the InfluxDB line protocol.
+type InfluxDBSink struct {
+	config configs.InfluxDBConfigModel
+}
+
+// NewInfluxDBSink ...
+func NewInfluxDBSink(config configs.InfluxDBConfigModel) InfluxDBSink {
+	return InfluxDBSink{config: config}
+}
+
+// Name ...
+func (s InfluxDBSink) Name() string {
+	return "influxdb"
+}
+
+// Send ...
+func (s InfluxDBSink) Send(buildAnalytics BuildAnalytics) error {
+	if s.config.File == "" && s.config.URL == "" {
+		return errors.New("neither file nor url is configured")
+	}
+
+	lines := influxLines(buildAnalytics)
+
+	if s.config.File != "" {
+		if err := appendToFile(s.config.File, lines); err != nil {
+			return fmt.Errorf("failed to write line protocol to %s: %s", s.config.File, err)
+		}
+	}
+
+	if s.config.URL != "" {
+		if err := s.write(lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s InfluxDBSink) write(lines []byte) error {
+	writeURL, err := url.Parse(strings.TrimSuffix(s.config.URL, "/") + "/api/v2/write")
+	if err != nil {
+		return fmt.Errorf("invalid influxdb url (%s): %s", s.config.URL, err)
+	}
+	writeURL.RawQuery = url.Values{
+		"org":       {s.config.Org},
+		"bucket":    {s.config.Bucket},
+		"precision": {"ns"},
+	}.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, writeURL.String(), bytes.NewReader(lines))
+	if err != nil {
+		return fmt.Errorf("failed to create influxdb write request: %s", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	}
+
+	client := http.Client{
+		Timeout: time.Duration(10 * time.Second),
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform influxdb write request: %s", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Errorf("failed to close response body, error: %#v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("influxdb write failed with status code: %d (%s)", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func appendToFile(pth string, content []byte) error {
+	f, err := os.OpenFile(pth, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func influxLines(buildAnalytics BuildAnalytics) []byte {
+	var buf bytes.Buffer
+
+	writeInfluxLine(&buf, influxBuildMeasurement,
+		withInfluxLabels(buildAnalytics.Labels, map[string]string{
+			"app_slug":    buildAnalytics.AppSlug,
+			"repo_id":     buildAnalytics.RepositoryID,
+			"stack_id":    buildAnalytics.StackID,
+			"platform":    buildAnalytics.Platform,
+			"cli_version": buildAnalytics.CLIVersion,
+			"workflow":    buildAnalytics.WorkflowName,
+			"status":      buildAnalytics.Status,
+		}),
+		[]influxField{
+			{"build_slug", influxString(buildAnalytics.BuildSlug)},
+			{"run_time", influxInteger(int64(buildAnalytics.Runtime))},
+			{"step_count", influxInteger(int64(len(buildAnalytics.StepAnalytics)))},
+		},
+		buildAnalytics.StartTime)
+
+	for _, step := range buildAnalytics.StepAnalytics {
+		startTime := step.StartTime
+		if startTime.IsZero() {
+			startTime = buildAnalytics.StartTime
+		}
+
+		fields := []influxField{
+			{"build_slug", influxString(buildAnalytics.BuildSlug)},
+			{"step_title", influxString(step.StepTitle)},
+			{"step_source", influxString(step.StepSource)},
+			{"run_time", influxInteger(int64(step.Runtime))},
+		}
+		for _, stepMetric := range step.Metrics {
+			fields = append(fields, influxField{"metric_" + stepMetric.Name, strconv.FormatFloat(stepMetric.Value, 'f', -1, 64)})
+		}
+
+		writeInfluxLine(&buf, influxStepMeasurement,
+			withInfluxLabels(buildAnalytics.Labels, map[string]string{
+				"app_slug":     buildAnalytics.AppSlug,
+				"stack_id":     buildAnalytics.StackID,
+				"platform":     buildAnalytics.Platform,
+				"workflow":     buildAnalytics.WorkflowName,
+				"step_id":      step.StepID,
+				"step_version": step.StepVersion,
+				"status":       step.Status,
+			}),
+			fields,
+			startTime)
+	}
+
+	return buf.Bytes()
+}
+
+// withInfluxLabels adds the labels to the tags as label_<key>.
+func withInfluxLabels(labels, tags map[string]string) map[string]string {
+	for key, value := range labels {
+		tags["label_"+key] = value
+	}
+	return tags
+}
+
+type influxField struct {
+	key   string
+	value string
+}
+
+func writeInfluxLine(buf *bytes.Buffer, measurement string, tags map[string]string, fields []influxField, timestamp time.Time) {
+	buf.WriteString(influxMeasurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		buf.WriteString("," + influxKeyEscaper.Replace(key) + "=" + influxKeyEscaper.Replace(tags[key]))
+	}
+
+	for i, field := range fields {
+		if i == 0 {
+			buf.WriteString(" ")
+		} else {
+			buf.WriteString(",")
+		}
+		buf.WriteString(influxKeyEscaper.Replace(field.key) + "=" + field.value)
+	}
+
+	if !timestamp.IsZero() {
+		buf.WriteString(" " + strconv.FormatInt(timestamp.UnixNano(), 10))
+	}
+	buf.WriteString("\n")
+}
+
+var (
+	// measurements: commas and spaces
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `)
+	// tag keys, tag values and field keys: commas, equal signs and spaces
+	influxKeyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+	// string field values: double quotes and backslashes
+	influxStringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+func influxString(value string) string {
+	return `"` + influxStringEscaper.Replace(value) + `"`
+}
+
+func influxInteger(value int64) string {
+	return strconv.FormatInt(value, 10) + "i"
+}
@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxLines(t *testing.T) {
+	startTime := time.Unix(1500000000, 0)
+
+	lines := influxLines(BuildAnalytics{
+		BuildAnalytics: analyticsModels.BuildAnalytics{
+			BuildSlug:    "slug",
+			StackID:      "linux-docker-android",
+			WorkflowName: "deploy to store",
+			Status:       "failed",
+			Runtime:      time.Second,
+			StartTime:    startTime,
+		},
+		StepAnalytics: []StepAnalytics{
+			{StepAnalytics: analyticsModels.StepAnalytics{
+				StepID:      "script",
+				StepTitle:   `Run "tests", a=b`,
+				StepVersion: "1.1.3",
+				StepSource:  `C:\steps`,
+				Status:      "failed",
+				StartTime:   startTime.Add(time.Second),
+				Runtime:     time.Second,
+			}},
+			{StepAnalytics: analyticsModels.StepAnalytics{
+				StepID:  "deploy,to=store",
+				Status:  "skipped",
+				Runtime: 0,
+			}},
+		},
+	})
+
+	require.Equal(t, `build,stack_id=linux-docker-android,status=failed,workflow=deploy\ to\ store build_slug="slug",run_time=1000000000i,step_count=2i 1500000000000000000
+step,stack_id=linux-docker-android,status=failed,step_id=script,step_version=1.1.3,workflow=deploy\ to\ store build_slug="slug",step_title="Run \"tests\", a=b",step_source="C:\\steps",run_time=1000000000i 1500000001000000000
+step,stack_id=linux-docker-android,status=skipped,step_id=deploy\,to\=store,workflow=deploy\ to\ store build_slug="slug",step_title="",step_source="",run_time=0i 1500000000000000000
+`, string(lines))
+}
+
+func TestInfluxDBSinkWrite(t *testing.T) {
+	var (
+		gotQuery, gotAuth, gotBody string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		gotQuery, gotAuth, gotBody = r.URL.Path+"?"+r.URL.RawQuery, r.Header.Get("Authorization"), string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxDBSink(configs.InfluxDBConfigModel{URL: server.URL + "/", Org: "org", Bucket: "ci", Token: "secret"})
+	require.NoError(t, sink.Send(testBuildAnalytics))
+
+	require.Equal(t, "/api/v2/write?bucket=ci&org=org&precision=ns", gotQuery)
+	require.Equal(t, "Token secret", gotAuth)
+	require.Equal(t, string(influxLines(testBuildAnalytics)), gotBody)
+}
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// LabelEnvPrefix prefixes the envs defining labels, e.g. BITRISE_ANALYTICS_LABEL_team=mobile.
+const LabelEnvPrefix = "BITRISE_ANALYTICS_LABEL_"
+
+const (
+	maxLabels           = 16
+	maxLabelKeyLength   = 32
+	maxLabelValueLength = 64
+)
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+	labelValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]+$`)
+)
+
+// ValidateLabel ...
+func ValidateLabel(key, value string) error {
+	if len(key) > maxLabelKeyLength {
+		return fmt.Errorf("key is longer than %d characters", maxLabelKeyLength)
+	}
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("key should start with a letter and contain only letters, digits, '_', '.' and '-'")
+	}
+	if len(value) > maxLabelValueLength {
+		return fmt.Errorf("value is longer than %d characters", maxLabelValueLength)
+	}
+	if !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("value should not be empty and contain only letters, digits, '_', '.', ':', '/' and '-'")
+	}
+	return nil
+}
+
+// Labels returns the valid labels defined in the config and the label envs, envs override the config.
+// Invalid labels and the ones above the maximum number of labels are dropped with a warning.
+func Labels(configLabels map[string]string, environ []string) map[string]string {
+	defined := map[string]string{}
+	for key, value := range configLabels {
+		defined[key] = value
+	}
+	for _, env := range environ {
+		if !strings.HasPrefix(env, LabelEnvPrefix) {
+			continue
+		}
+		if split := strings.SplitN(strings.TrimPrefix(env, LabelEnvPrefix), "=", 2); len(split) == 2 {
+			defined[split[0]] = split[1]
+		}
+	}
+
+	labels := map[string]string{}
+	for _, key := range sortedLabelKeys(defined) {
+		if err := ValidateLabel(key, defined[key]); err != nil {
+			log.Warnf("Dropping invalid label %s: %s", key, err)
+			continue
+		}
+		if len(labels) == maxLabels {
+			log.Warnf("Dropping label %s: more than %d labels defined", key, maxLabels)
+			continue
+		}
+		labels[key] = defined[key]
+	}
+	return labels
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func enrichLabels(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	if labels := Labels(config.Labels, os.Environ()); len(labels) > 0 {
+		buildAnalytics.Labels = labels
+	}
+	return nil
+}
+
+// ParseLabelFilter parses a key=value label filter.
+func ParseLabelFilter(filter string) (string, string, error) {
+	split := strings.SplitN(filter, "=", 2)
+	if len(split) != 2 || split[0] == "" {
+		return "", "", fmt.Errorf("invalid label filter: %s (expected format: key=value)", filter)
+	}
+	return split[0], split[1], nil
+}
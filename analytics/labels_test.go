@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	configLabels := map[string]string{
+		"team":    "web",
+		"product": "shop",
+		"1st":     "invalid key",
+		"owner":   "invalid value!",
+	}
+	environ := []string{
+		"BITRISE_ANALYTICS_LABEL_team=mobile",
+		"BITRISE_ANALYTICS_LABEL_long=" + strings.Repeat("x", 65),
+		"BITRISE_ANALYTICS_LABEL_",
+		"OTHER_ENV=value",
+	}
+
+	require.Equal(t, map[string]string{"team": "mobile", "product": "shop"}, Labels(configLabels, environ))
+}
+
+func TestLabelsLimit(t *testing.T) {
+	configLabels := map[string]string{}
+	for i := 0; i < 20; i++ {
+		configLabels[fmt.Sprintf("label%02d", i)] = "value"
+	}
+
+	labels := Labels(configLabels, nil)
+	require.Len(t, labels, 16)
+	require.Contains(t, labels, "label15")
+	require.NotContains(t, labels, "label16")
+}
+
+func TestHistoryFilter(t *testing.T) {
+	buildAnalytics := testBuildAnalytics
+	buildAnalytics.Labels = map[string]string{"team": "mobile", "product": "shop"}
+
+	require.True(t, HistoryFilter{}.Match(buildAnalytics))
+	require.True(t, HistoryFilter{Workflow: "primary", Labels: map[string]string{"team": "mobile"}}.Match(buildAnalytics))
+	require.False(t, HistoryFilter{Workflow: "deploy"}.Match(buildAnalytics))
+	require.False(t, HistoryFilter{Labels: map[string]string{"team": "web"}}.Match(buildAnalytics))
+	require.False(t, HistoryFilter{Labels: map[string]string{"owner": "me"}}.Match(buildAnalytics))
+}
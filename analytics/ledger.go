@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const ledgerFileName = "ledger.jsonl"
+
+// DestinationCollector is the ledger destination of the analytics collector,
+// the other destinations are the hooks (hook:NAME) and the sinks (sink:NAME).
+const DestinationCollector = "collector"
+
+// Delivery is a ledger record of a build delivered to a destination.
+type Delivery struct {
+	SubmissionID string    `json:"submission_id"`
+	Destination  string    `json:"destination"`
+	DeliveredAt  time.Time `json:"delivered_at"`
+}
+
+// HookDestination is the ledger destination of the hook.
+func HookDestination(name string) string {
+	return "hook:" + name
+}
+
+// SinkDestination is the ledger destination of the sink.
+func SinkDestination(name string) string {
+	return "sink:" + name
+}
+
+// NewSubmissionID returns the build's deterministic submission ID: its build slug,
+// or its payload hash for builds without slug. It is empty if the build has neither.
+func NewSubmissionID(buildAnalytics BuildAnalytics) string {
+	if buildAnalytics.BuildSlug != "" {
+		return buildAnalytics.BuildSlug
+	}
+	return buildAnalytics.PayloadHash
+}
+
+func ledgerFilePath() (string, error) {
+	if configs.DataDir == "" {
+		return "", errors.New("plugin data dir is not set")
+	}
+	return filepath.Join(configs.DataDir, ledgerFileName), nil
+}
+
+// RecordDelivery records the delivery of the submission ID to the destination in the plugin's local ledger.
+func RecordDelivery(submissionID, destination string, deliveredAt time.Time) error {
+	pth, err := ledgerFilePath()
+	if err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(Delivery{SubmissionID: submissionID, Destination: destination, DeliveredAt: deliveredAt})
+	if err != nil {
+		return err
+	}
+	return appendToFile(pth, append(record, '\n'))
+}
+
+// DeliveredDestinations returns the destinations the submission ID is recorded as delivered to in the ledger.
+func DeliveredDestinations(submissionID string) (map[string]bool, error) {
+	pth, err := ledgerFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	destinations := map[string]bool{}
+	f, err := os.Open(pth)
+	if os.IsNotExist(err) {
+		return destinations, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close ledger file: %s", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var delivery Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &delivery); err != nil {
+			log.Debugf("Skipping invalid ledger record (line %d): %s", line, err)
+			continue
+		}
+		if delivery.SubmissionID == submissionID {
+			destinations[delivery.Destination] = true
+		}
+	}
+	return destinations, scanner.Err()
+}
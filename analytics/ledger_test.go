@@ -0,0 +1,70 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSubmissionID(t *testing.T) {
+	payload := BuildRunResults{}
+	payload.ProjectType = "ios"
+	buildAnalytics := NewBuildAnalytics(payload)
+	buildAnalytics.BuildSlug = ""
+	require.Len(t, NewSubmissionID(buildAnalytics), 64)
+	require.Equal(t, buildAnalytics.PayloadHash, NewSubmissionID(buildAnalytics))
+	require.Equal(t, NewSubmissionID(buildAnalytics), NewSubmissionID(NewBuildAnalytics(payload)))
+
+	payload.ProjectType = "android"
+	require.NotEqual(t, NewSubmissionID(buildAnalytics), NewSubmissionID(NewBuildAnalytics(payload)))
+
+	buildAnalytics.BuildSlug = "build-slug"
+	require.Equal(t, "build-slug", NewSubmissionID(buildAnalytics))
+}
+
+func TestLedger(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("ledger")
+	require.NoError(t, err)
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	destinations, err := DeliveredDestinations("build-slug")
+	require.NoError(t, err)
+	require.Empty(t, destinations)
+
+	require.NoError(t, RecordDelivery("build-slug", HookDestination("notify"), time.Now()))
+	require.NoError(t, RecordDelivery("build-slug", DestinationCollector, time.Now()))
+	destinations, err = DeliveredDestinations("build-slug")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"hook:notify": true, "collector": true}, destinations)
+
+	destinations, err = DeliveredDestinations("other-build-slug")
+	require.NoError(t, err)
+	require.Empty(t, destinations)
+}
+
+func TestAnalyticsRequestIdempotencyKey(t *testing.T) {
+	buildAnalytics := BuildAnalytics{
+		BuildAnalytics: analyticsModels.BuildAnalytics{BuildSlug: "build-slug"},
+		SubmissionID:   "build-slug",
+	}
+
+	req, err := newAnalyticsRequest(buildAnalytics, []byte("{}"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "build-slug", req.Header.Get("Idempotency-Key"))
+
+	req, err = newAnalyticsRequest(buildAnalytics, nil, &configs.CloudEventsConfigModel{URL: "https://collector.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "build-slug", req.Header.Get("Idempotency-Key"))
+
+	req, err = newAnalyticsRequest(BuildAnalytics{}, []byte("{}"), nil)
+	require.NoError(t, err)
+	require.Empty(t, req.Header.Get("Idempotency-Key"))
+}
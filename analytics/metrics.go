@@ -0,0 +1,161 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	bitriseConfigs "github.com/bitrise-io/bitrise/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// StepMetricsFile is the path, relative to BITRISE_TMP_DIR, steps append their metric records to.
+// Every line is a JSON object like {"step_idx": 2, "name": "tests.count", "value": 132, "unit": "count"},
+// where step_idx is the idx of the reporting step, its 0 based index in the build.
+const StepMetricsFile = "analytics/metrics.ndjson"
+
+const (
+	maxStepMetricsFileSize = 256 * 1024
+	maxStepMetricsPerStep  = 32
+)
+
+var (
+	stepMetricNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.]{0,63}$`)
+	stepMetricUnitPattern = regexp.MustCompile(`^[a-z_%/]{0,16}$`)
+)
+
+// StepMetric is a custom metric reported by a step.
+type StepMetric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+type stepMetricRecord struct {
+	StepIdx *int     `json:"step_idx"`
+	StepID  string   `json:"step_id,omitempty"`
+	Name    string   `json:"name"`
+	Value   *float64 `json:"value"`
+	Unit    string   `json:"unit,omitempty"`
+}
+
+// validate checks the record and returns the reporting step.
+func (r stepMetricRecord) validate(steps []StepAnalytics) (*StepAnalytics, error) {
+	if r.StepIdx == nil {
+		return nil, errors.New("missing step_idx")
+	}
+	step := stepByIdx(steps, *r.StepIdx)
+	if step == nil {
+		return nil, fmt.Errorf("no step with index %d", *r.StepIdx)
+	}
+	if r.StepID != "" && r.StepID != step.StepID {
+		return nil, fmt.Errorf("step %d is %s, not %s", *r.StepIdx, step.StepID, r.StepID)
+	}
+	if !stepMetricNamePattern.MatchString(r.Name) {
+		return nil, fmt.Errorf("invalid name: %q", r.Name)
+	}
+	if r.Value == nil || math.IsNaN(*r.Value) || math.IsInf(*r.Value, 0) {
+		return nil, errors.New("missing or invalid value")
+	}
+	if !stepMetricUnitPattern.MatchString(r.Unit) {
+		return nil, fmt.Errorf("invalid unit: %q", r.Unit)
+	}
+	return step, nil
+}
+
+// stepByIdx returns the step of the idx, nil if there is none.
+func stepByIdx(steps []StepAnalytics, idx int) *StepAnalytics {
+	for i := range steps {
+		if steps[i].Idx == idx {
+			return &steps[i]
+		}
+	}
+	return nil
+}
+
+// hasStepMetric tells whether the metrics include one with the name.
+func hasStepMetric(metrics []StepMetric, name string) bool {
+	for _, metric := range metrics {
+		if metric.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachStepMetrics reads the metric records and attaches the valid ones to the reporting steps.
+// Invalid and unknown records, the names a step already reported, and the records above the size
+// or count limits are dropped with a warning.
+func AttachStepMetrics(r io.Reader, steps []StepAnalytics) error {
+	content, err := ioutil.ReadAll(io.LimitReader(r, maxStepMetricsFileSize+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > maxStepMetricsFileSize {
+		log.Warnf("Step metrics exceed %d bytes, the rest is dropped", maxStepMetricsFileSize)
+		content = content[:maxStepMetricsFileSize]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, maxStepMetricsFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		var record stepMetricRecord
+		if err := dec.Decode(&record); err != nil {
+			log.Warnf("Rejected step metric (line %d): %s", line, err)
+			continue
+		}
+		step, err := record.validate(steps)
+		if err != nil {
+			log.Warnf("Rejected step metric (line %d): %s", line, err)
+			continue
+		}
+
+		if hasStepMetric(step.Metrics, record.Name) {
+			log.Warnf("Rejected step metric (line %d): step %d already reported %s", line, *record.StepIdx, record.Name)
+			continue
+		}
+		if len(step.Metrics) == maxStepMetricsPerStep {
+			log.Warnf("Rejected step metric (line %d): step %d reported more than %d metrics", line, *record.StepIdx, maxStepMetricsPerStep)
+			continue
+		}
+		step.Metrics = append(step.Metrics, StepMetric{Name: record.Name, Value: *record.Value, Unit: record.Unit})
+	}
+	return scanner.Err()
+}
+
+func enrichStepMetrics(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	tmpDir := os.Getenv(bitriseConfigs.BitriseTmpDirEnvKey)
+	if tmpDir == "" {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(tmpDir, StepMetricsFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close step metrics file: %s", err)
+		}
+	}()
+
+	return AttachStepMetrics(f, buildAnalytics.StepAnalytics)
+}
@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachStepMetrics(t *testing.T) {
+	steps := []StepAnalytics{
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "script"}, Idx: 0},
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test"}, Idx: 1},
+	}
+
+	records := strings.Join([]string{
+		`{"step_idx": 1, "step_id": "xcode-test", "name": "tests.count", "value": 132, "unit": "count"}`,
+		`{"step_idx": 0, "name": "cache.hit_ratio", "value": 0.75}`,
+		`{"step_idx": 1, "name": "tests.count", "value": 140}`,
+		``,
+		`{"step_idx": 2, "name": "tests.count", "value": 1}`,
+		`{"step_idx": 0, "step_id": "xcode-test", "name": "tests.count", "value": 1}`,
+		`{"name": "tests.count", "value": 1}`,
+		`{"step_idx": 0, "name": "Binary Size", "value": 1}`,
+		`{"step_idx": 0, "name": "binary.size"}`,
+		`{"step_idx": 0, "name": "binary.size", "value": 1, "test_name": "secret"}`,
+		`not json`,
+	}, "\n")
+
+	require.NoError(t, AttachStepMetrics(strings.NewReader(records), steps))
+	require.Equal(t, []StepMetric{{Name: "cache.hit_ratio", Value: 0.75}}, steps[0].Metrics)
+	require.Equal(t, []StepMetric{{Name: "tests.count", Value: 132, Unit: "count"}}, steps[1].Metrics)
+}
+
+func TestAttachStepMetricsByIdx(t *testing.T) {
+	// a step is missing, the rest are not in idx order
+	steps := []StepAnalytics{
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test"}, Idx: 2},
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "script"}, Idx: 0},
+	}
+
+	records := strings.Join([]string{
+		`{"step_idx": 2, "step_id": "xcode-test", "name": "tests.count", "value": 132}`,
+		`{"step_idx": 0, "name": "cache.hit_ratio", "value": 0.75}`,
+		`{"step_idx": 1, "name": "tests.count", "value": 1}`,
+	}, "\n")
+
+	require.NoError(t, AttachStepMetrics(strings.NewReader(records), steps))
+	require.Equal(t, []StepMetric{{Name: "tests.count", Value: 132}}, steps[0].Metrics)
+	require.Equal(t, []StepMetric{{Name: "cache.hit_ratio", Value: 0.75}}, steps[1].Metrics)
+}
+
+func TestAttachStepMetricsLimits(t *testing.T) {
+	steps := []StepAnalytics{{StepAnalytics: analyticsModels.StepAnalytics{StepID: "script"}}}
+
+	var records strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&records, `{"step_idx": 0, "name": "count_%d", "value": 1}`+"\n", i)
+	}
+	require.NoError(t, AttachStepMetrics(strings.NewReader(records.String()), steps))
+	require.Len(t, steps[0].Metrics, maxStepMetricsPerStep)
+
+	steps[0].Metrics = nil
+	for i := 40; records.Len() <= maxStepMetricsFileSize+100; i++ {
+		fmt.Fprintf(&records, `{"step_idx": 0, "name": "count_%d", "value": 1}`+"\n", i)
+	}
+	require.NoError(t, AttachStepMetrics(strings.NewReader(records.String()), steps))
+	require.Len(t, steps[0].Metrics, maxStepMetricsPerStep)
+}
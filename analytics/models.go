@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"time"
+
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+)
+
+// BuildAnalytics is the analytics service's build model
+// extended with the sections collected by the plugin.
+type BuildAnalytics struct {
+	analyticsModels.BuildAnalytics
+
+	// StepAnalytics shadows the analytics service's step list.
+	StepAnalytics []StepAnalytics `json:"step_analytics"`
+
+	// Runtime is the sum of the steps' runtimes, WallClockRuntime lasts from the build's start
+	// to the end of its last step and Overhead is the time spent outside of the steps.
+	WallClockRuntime time.Duration  `json:"wall_clock_runtime,omitempty"`
+	Overhead         *time.Duration `json:"overhead,omitempty"`
+	// QueueTime lasts from the build's trigger to the start of the run,
+	// StartupOverhead from the start of the run to the start of the first step.
+	QueueTime       *time.Duration `json:"queue_time,omitempty"`
+	StartupOverhead *time.Duration `json:"startup_overhead,omitempty"`
+
+	TriggerContext *TriggerContext   `json:"trigger_context,omitempty"`
+	Pipeline       *PipelineContext  `json:"pipeline,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+
+	Artifacts map[string]ArtifactSizes `json:"artifacts,omitempty"`
+
+	// PayloadHash identifies the build run results the build analytics was created from.
+	PayloadHash string `json:"payload_hash,omitempty"`
+	// SubmissionID is the same for every delivery of the build, see NewSubmissionID.
+	SubmissionID string `json:"submission_id,omitempty"`
+}
+
+// Model ...
+func (a BuildAnalytics) Model() interface{} {
+	return a
+}
+
+// StepAnalytics is the analytics service's step model
+// extended with the data collected by the plugin.
+type StepAnalytics struct {
+	analyticsModels.StepAnalytics
+
+	// Idx is the step's index in the build reported by the Bitrise CLI, it identifies the step
+	// even if processors remove or reorder the steps.
+	Idx int `json:"idx"`
+	// StatusCode is the step run status code reported by the Bitrise CLI, kept for statuses unknown to the plugin.
+	StatusCode int `json:"status_code"`
+	// GapBeforeStart is the time between the end of the previous step, or the build's start, and the step's start.
+	GapBeforeStart *time.Duration `json:"gap_before_start,omitempty"`
+	Metrics        []StepMetric   `json:"metrics,omitempty"`
+	TestResults    *TestResults   `json:"test_results,omitempty"`
+}
+
+// Model ...
+func (a StepAnalytics) Model() interface{} {
+	return a
+}
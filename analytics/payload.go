@@ -0,0 +1,288 @@
+package analytics
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/bitrise/models"
+)
+
+// DefaultPayloadFormatVersion is the format version of the vendored Bitrise CLI models.
+const DefaultPayloadFormatVersion = models.Version
+
+// BuildRunResults is the build run results decoded from any supported format version.
+type BuildRunResults struct {
+	models.BuildRunResultsModel
+
+	// StepDetails holds what newer formats report about the steps beyond the vendored model, by step index.
+	StepDetails map[int]StepRunDetails
+	// Extras holds the fields unknown to the payload's decoder.
+	Extras map[string]json.RawMessage
+
+	// stepDetailsAt holds the decoded step details by the steps' position,
+	// they are re-keyed by it if fixing the payload renumbers the steps.
+	stepDetailsAt map[stepPosition]StepRunDetails
+}
+
+// stepPosition is the position of a step in the step lists of the payload.
+type stepPosition struct {
+	field string
+	index int
+}
+
+// StepRunDetails are the details of a step the vendored model cannot represent.
+type StepRunDetails struct {
+	// Extras holds the step's fields unknown to the payload's decoder.
+	Extras map[string]json.RawMessage
+}
+
+// PayloadDecoder decodes a build run results payload from the JSON decoder's input into the normalized model.
+type PayloadDecoder func(dec *json.Decoder) (BuildRunResults, error)
+
+// payloadDecoders are keyed by the format version they were written for,
+// a decoder also decodes the older formats, as fields are only added to the format.
+var payloadDecoders = map[string]PayloadDecoder{
+	"11": decodePayload,
+}
+
+// NewPayloadDecoder returns the decoder registered for the format version.
+func NewPayloadDecoder(formatVersion string) (PayloadDecoder, error) {
+	decoder, ok := payloadDecoders[formatVersion]
+	if !ok {
+		return nil, fmt.Errorf("no payload decoder for format version %s (options: %s)", formatVersion, strings.Join(payloadDecoderVersions(), ", "))
+	}
+	return decoder, nil
+}
+
+// DefaultPayloadDecoder returns the decoder of the vendored models' format version.
+func DefaultPayloadDecoder() PayloadDecoder {
+	return payloadDecoders[DefaultPayloadFormatVersion]
+}
+
+// DecodePayload decodes the payload with the decoder of the vendored models' format version.
+func DecodePayload(payload []byte) (BuildRunResults, error) {
+	return DefaultPayloadDecoder().Decode(payload)
+}
+
+// Decode decodes the payload, which must not be followed by other data.
+func (d PayloadDecoder) Decode(payload []byte) (BuildRunResults, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	buildRunResults, err := d(dec)
+	if err == io.EOF {
+		return BuildRunResults{}, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return BuildRunResults{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return BuildRunResults{}, fmt.Errorf("unexpected data after the payload at offset %d", dec.InputOffset())
+	}
+	return buildRunResults, nil
+}
+
+func payloadDecoderVersions() []string {
+	versions := make([]string, 0, len(payloadDecoders))
+	for version := range payloadDecoders {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+var (
+	buildRunResultsFields = jsonFields(reflect.TypeOf(models.BuildRunResultsModel{}))
+	stepRunResultsFields  = jsonFields(reflect.TypeOf(models.StepRunResultsModel{}))
+)
+
+// jsonFields returns the indexes of the struct's fields by their JSON names.
+func jsonFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+// decodePayload decodes the payload in a single pass over the decoder's input: the fields of the vendored model
+// are decoded into it as they are read, the step lists step by step, and the other fields are kept in the extras.
+func decodePayload(dec *json.Decoder) (BuildRunResults, error) {
+	var results BuildRunResults
+	lists := map[string]*[]models.StepRunResultsModel{}
+	for _, list := range stepLists(&results.BuildRunResultsModel) {
+		lists[list.field] = list.steps
+	}
+
+	extras, err := decodeObject(dec, reflect.ValueOf(&results.BuildRunResultsModel).Elem(), buildRunResultsFields, func(field string) (bool, error) {
+		steps, ok := lists[field]
+		if !ok {
+			return false, nil
+		}
+		return true, decodeSteps(dec, field, steps, &results)
+	})
+	if err != nil {
+		return BuildRunResults{}, err
+	}
+	results.Extras = extras
+	return results, nil
+}
+
+// decodeSteps decodes the step list field's steps one by one, and keeps their unknown fields in the step details.
+func decodeSteps(dec *json.Decoder, field string, steps *[]models.StepRunResultsModel, results *BuildRunResults) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if token != json.Delim('[') {
+		return &json.UnmarshalTypeError{Value: tokenKind(token), Type: reflect.TypeOf(*steps), Offset: dec.InputOffset(), Field: field}
+	}
+
+	*steps = []models.StepRunResultsModel{}
+	for i := 0; dec.More(); i++ {
+		var step models.StepRunResultsModel
+		extras, err := decodeObject(dec, reflect.ValueOf(&step).Elem(), stepRunResultsFields, nil)
+		if err != nil {
+			return err
+		}
+		*steps = append(*steps, step)
+
+		if extras != nil {
+			details := StepRunDetails{Extras: extras}
+			if results.StepDetails == nil {
+				results.StepDetails = map[int]StepRunDetails{}
+			}
+			results.StepDetails[step.Idx] = details
+
+			if results.stepDetailsAt == nil {
+				results.stepDetailsAt = map[stepPosition]StepRunDetails{}
+			}
+			results.stepDetailsAt[stepPosition{field: field, index: i}] = details
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeObject decodes the decoder's next object into the struct field by field, the fields decodeField
+// handles are decoded by it, and the fields unknown to the struct are returned, nil if there are none.
+// A null leaves the struct unchanged, as with json.Unmarshal.
+func decodeObject(dec *json.Decoder, v reflect.Value, fields map[string]int, decodeField func(field string) (bool, error)) (map[string]json.RawMessage, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if token != json.Delim('{') {
+		return nil, &json.UnmarshalTypeError{Value: tokenKind(token), Type: v.Type(), Offset: dec.InputOffset()}
+	}
+
+	var extras map[string]json.RawMessage
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		field := token.(string)
+
+		if decodeField != nil {
+			if handled, err := decodeField(field); err != nil {
+				return nil, err
+			} else if handled {
+				continue
+			}
+		}
+
+		if i, ok := fields[field]; ok {
+			if err := decodeValue(dec, v.Field(i).Addr().Interface()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if extras == nil {
+			extras = map[string]json.RawMessage{}
+		}
+		extras[field] = value
+	}
+	_, err = dec.Token()
+	return extras, err
+}
+
+// decodeValue decodes the decoder's next value into v. The json.Decoder reports the offset
+// of an unmarshal error relative to the value, it is made relative to the input.
+func decodeValue(dec *json.Decoder, v interface{}) error {
+	start := valueStart(dec)
+	err := dec.Decode(v)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		typeErr.Offset += start
+	}
+	return err
+}
+
+// valueStart returns the input offset of the decoder's next value, after the colon or the comma
+// and the whitespaces before it, as far as they are already buffered.
+func valueStart(dec *json.Decoder) int64 {
+	offset := dec.InputOffset()
+	buffered := dec.Buffered().(io.ByteReader)
+	separated := false
+	for {
+		b, err := buffered.ReadByte()
+		if err != nil {
+			return offset
+		}
+		switch {
+		case b == ' ' || b == '\t' || b == '\r' || b == '\n':
+		case (b == ':' || b == ',') && !separated:
+			separated = true
+		default:
+			return offset
+		}
+		offset++
+	}
+}
+
+// tokenKind describes the kind of the JSON value the token starts, as json.UnmarshalTypeError does.
+func tokenKind(token json.Token) string {
+	switch token {
+	case json.Delim('{'):
+		return "object"
+	case json.Delim('['):
+		return "array"
+	}
+	switch token.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return "null"
+}
+
+// PayloadHash returns the SHA-256 hash of the build run results' canonical JSON encoding,
+// which does not depend on the formatting and field order of the payload.
+func PayloadHash(buildRunResults models.BuildRunResultsModel) string {
+	content, err := json.Marshal(buildRunResults)
+	if err != nil {
+		// the build run results model is always encodable
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
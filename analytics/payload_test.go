@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const newerFormatPayload = `{
+	"project_type": "ios",
+	"workflow_id": "primary",
+	"success_steps": [
+		{
+			"step_info": {"id": "script", "version": "1.1.3"},
+			"status": 0,
+			"idx": 0,
+			"step_bundle": {"id": "setup", "title": "Setup"},
+			"step_execution_id": "abc"
+		},
+		{
+			"step_info": {"id": "deploy-to-bitrise-io", "version": "2.0.0"},
+			"status": 0,
+			"idx": 1
+		}
+	],
+	"failed_steps": null
+}`
+
+func TestPayloadDecoders(t *testing.T) {
+	decoder, err := NewPayloadDecoder("11")
+	require.NoError(t, err)
+
+	// the fields of newer formats are kept in the extras
+	results, err := decoder.Decode([]byte(newerFormatPayload))
+	require.NoError(t, err)
+	require.Equal(t, "ios", results.ProjectType)
+	require.Equal(t, 2, len(results.SuccessSteps))
+	require.Equal(t, map[string]json.RawMessage{"workflow_id": json.RawMessage(`"primary"`)}, results.Extras)
+	require.Equal(t, map[int]StepRunDetails{
+		0: {
+			Extras: map[string]json.RawMessage{
+				"step_bundle":       json.RawMessage(`{"id": "setup", "title": "Setup"}`),
+				"step_execution_id": json.RawMessage(`"abc"`),
+			},
+		},
+	}, results.StepDetails)
+
+	_, err = decoder.Decode([]byte(`{"success_steps": [{"idx": "0"}]}`))
+	require.Error(t, err)
+
+	_, err = NewPayloadDecoder("12")
+	require.Error(t, err)
+}
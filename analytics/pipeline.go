@@ -0,0 +1,172 @@
+package analytics
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+)
+
+const (
+	pipelineIDEnvKey    = "BITRISEIO_PIPELINE_ID"
+	pipelineTitleEnvKey = "BITRISEIO_PIPELINE_TITLE"
+	stageIDEnvKey       = "BITRISEIO_STAGE_ID"
+	stageTitleEnvKey    = "BITRISEIO_STAGE_TITLE"
+)
+
+// PipelineContext identifies the pipeline and the stage the build ran in.
+type PipelineContext struct {
+	PipelineID    string `json:"pipeline_id"`
+	PipelineTitle string `json:"pipeline_title,omitempty"`
+	StageID       string `json:"stage_id,omitempty"`
+	StageTitle    string `json:"stage_title,omitempty"`
+}
+
+// NewPipelineContext reads the pipeline context from the envs exported by Bitrise,
+// it returns nil for builds not running in a pipeline.
+func NewPipelineContext(getenv func(string) string) *PipelineContext {
+	pipelineID := getenv(pipelineIDEnvKey)
+	if pipelineID == "" {
+		return nil
+	}
+	return &PipelineContext{
+		PipelineID:    pipelineID,
+		PipelineTitle: getenv(pipelineTitleEnvKey),
+		StageID:       getenv(stageIDEnvKey),
+		StageTitle:    getenv(stageTitleEnvKey),
+	}
+}
+
+func enrichPipelineContext(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	buildAnalytics.Pipeline = NewPipelineContext(os.Getenv)
+	return nil
+}
+
+// PipelineStage is a stage of a pipeline timeline with its builds, ordered by start time.
+// The stage starts when its first build starts and ends when its last build ends.
+type PipelineStage struct {
+	ID    string
+	Title string
+	Start time.Time
+	End   time.Time
+	// IdleBefore is the time between the end of the previous stage and the start of this one.
+	IdleBefore time.Duration
+	Builds     []BuildAnalytics
+	// CriticalBuild is the index of the build the stage waited for: the one ending last.
+	CriticalBuild int
+}
+
+// PipelineTimeline is a pipeline rebuilt from the builds recorded in the local history.
+type PipelineTimeline struct {
+	ID     string
+	Title  string
+	Start  time.Time
+	End    time.Time
+	Stages []PipelineStage
+}
+
+// Duration is the wall-clock time from the start of the first build to the end of the last one.
+func (t PipelineTimeline) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+// IdleTime is the time spent between the stages.
+func (t PipelineTimeline) IdleTime() time.Duration {
+	var idle time.Duration
+	for _, stage := range t.Stages {
+		idle += stage.IdleBefore
+	}
+	return idle
+}
+
+// CriticalPath returns the builds each stage waited for, in stage order:
+// shortening any other build does not shorten the pipeline.
+func (t PipelineTimeline) CriticalPath() []BuildAnalytics {
+	path := make([]BuildAnalytics, 0, len(t.Stages))
+	for _, stage := range t.Stages {
+		path = append(path, stage.Builds[stage.CriticalBuild])
+	}
+	return path
+}
+
+func buildEndTime(buildAnalytics BuildAnalytics) time.Time {
+	if buildAnalytics.WallClockRuntime > 0 {
+		return buildAnalytics.StartTime.Add(buildAnalytics.WallClockRuntime)
+	}
+	return buildAnalytics.StartTime.Add(buildAnalytics.Runtime)
+}
+
+// NewPipelineTimeline rebuilds the pipeline's timeline from the builds recorded in the local history.
+// Stages are ordered by their start time, a build recorded more than once counts once.
+func NewPipelineTimeline(pipelineID string, history []BuildAnalytics) (PipelineTimeline, error) {
+	timeline := PipelineTimeline{ID: pipelineID}
+
+	var (
+		stageIDs    []string
+		stages      = map[string]*PipelineStage{}
+		buildSlugs  = map[string]bool{}
+		buildsCount int
+	)
+	// the most recent record of a build wins
+	for i := len(history) - 1; i >= 0; i-- {
+		buildAnalytics := history[i]
+		if buildAnalytics.Pipeline == nil || buildAnalytics.Pipeline.PipelineID != pipelineID {
+			continue
+		}
+		if buildAnalytics.BuildSlug != "" {
+			if buildSlugs[buildAnalytics.BuildSlug] {
+				continue
+			}
+			buildSlugs[buildAnalytics.BuildSlug] = true
+		}
+		if timeline.Title == "" {
+			timeline.Title = buildAnalytics.Pipeline.PipelineTitle
+		}
+
+		stage, ok := stages[buildAnalytics.Pipeline.StageID]
+		if !ok {
+			stage = &PipelineStage{ID: buildAnalytics.Pipeline.StageID, Title: buildAnalytics.Pipeline.StageTitle}
+			stages[stage.ID] = stage
+			stageIDs = append(stageIDs, stage.ID)
+		}
+		stage.Builds = append(stage.Builds, buildAnalytics)
+		buildsCount++
+	}
+	if buildsCount == 0 {
+		return PipelineTimeline{}, fmt.Errorf("no builds of pipeline %s in the local history", pipelineID)
+	}
+
+	for _, stageID := range stageIDs {
+		stage := stages[stageID]
+		sort.SliceStable(stage.Builds, func(i, j int) bool {
+			return stage.Builds[i].StartTime.Before(stage.Builds[j].StartTime)
+		})
+
+		stage.Start = stage.Builds[0].StartTime
+		for i, buildAnalytics := range stage.Builds {
+			if end := buildEndTime(buildAnalytics); end.After(stage.End) {
+				stage.End = end
+				stage.CriticalBuild = i
+			}
+		}
+		timeline.Stages = append(timeline.Stages, *stage)
+	}
+	sort.SliceStable(timeline.Stages, func(i, j int) bool {
+		return timeline.Stages[i].Start.Before(timeline.Stages[j].Start)
+	})
+
+	timeline.Start = timeline.Stages[0].Start
+	for i := range timeline.Stages {
+		stage := &timeline.Stages[i]
+		// overlapping stages have no idle time between them
+		if i > 0 && stage.Start.After(timeline.End) {
+			stage.IdleBefore = stage.Start.Sub(timeline.End)
+		}
+		if stage.End.After(timeline.End) {
+			timeline.End = stage.End
+		}
+	}
+	return timeline, nil
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPipelineContext(t *testing.T) {
+	require.Nil(t, NewPipelineContext(func(string) string { return "" }))
+
+	envs := map[string]string{
+		"BITRISEIO_PIPELINE_ID":    "pipeline-1",
+		"BITRISEIO_PIPELINE_TITLE": "release",
+		"BITRISEIO_STAGE_ID":       "stage-1",
+		"BITRISEIO_STAGE_TITLE":    "test",
+	}
+	require.Equal(t, &PipelineContext{
+		PipelineID:    "pipeline-1",
+		PipelineTitle: "release",
+		StageID:       "stage-1",
+		StageTitle:    "test",
+	}, NewPipelineContext(func(key string) string { return envs[key] }))
+}
+
+func TestNewPipelineTimeline(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	build := func(slug, stageID string, startOffset, runtime time.Duration) BuildAnalytics {
+		return BuildAnalytics{
+			BuildAnalytics: analyticsModels.BuildAnalytics{
+				BuildSlug: slug,
+				StartTime: start.Add(startOffset),
+				Runtime:   runtime,
+			},
+			Pipeline: &PipelineContext{PipelineID: "pipeline-1", PipelineTitle: "release", StageID: stageID},
+		}
+	}
+
+	history := []BuildAnalytics{
+		build("build-1", "build", 0, 5*time.Minute),
+		build("build-2", "build", time.Minute, 3*time.Minute),
+		build("other", "build", 0, time.Hour),
+		// re-recorded build, the last record wins
+		build("build-3", "test", 9*time.Minute, time.Minute),
+		build("build-3", "test", 7*time.Minute, 2*time.Minute),
+		build("build-4", "test", 7*time.Minute, 4*time.Minute),
+		build("build-5", "deploy", 11*time.Minute, time.Minute),
+	}
+	history[2].Pipeline = &PipelineContext{PipelineID: "pipeline-2"}
+	history = append(history, BuildAnalytics{BuildAnalytics: analyticsModels.BuildAnalytics{BuildSlug: "no-pipeline"}})
+
+	timeline, err := NewPipelineTimeline("pipeline-1", history)
+	require.NoError(t, err)
+	require.Equal(t, "release", timeline.Title)
+	require.Equal(t, 12*time.Minute, timeline.Duration())
+	require.Equal(t, 2*time.Minute, timeline.IdleTime())
+
+	var stageIDs []string
+	var idles []time.Duration
+	for _, stage := range timeline.Stages {
+		stageIDs = append(stageIDs, stage.ID)
+		idles = append(idles, stage.IdleBefore)
+	}
+	require.Equal(t, []string{"build", "test", "deploy"}, stageIDs)
+	require.Equal(t, []time.Duration{0, 2 * time.Minute, 0}, idles)
+	require.Equal(t, 2, len(timeline.Stages[1].Builds))
+
+	var criticalPath []string
+	for _, buildAnalytics := range timeline.CriticalPath() {
+		criticalPath = append(criticalPath, buildAnalytics.BuildSlug)
+	}
+	require.Equal(t, []string{"build-1", "build-4", "build-5"}, criticalPath)
+
+	_, err = NewPipelineTimeline("unknown", history)
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// RunProcessors pipes the build analytics through the processors, each one reading the previous one's output.
+// If any of the stages fails or its output is not valid build analytics,
+// the unmodified build analytics is returned.
+func RunProcessors(processors []configs.ProcessorConfigModel, buildAnalytics BuildAnalytics) BuildAnalytics {
+	processed := buildAnalytics
+	for _, processor := range processors {
+		var err error
+		if processed, err = runProcessor(processor, processed); err != nil {
+			log.Warnf("Processor %s failed, sending the unmodified analytics: %s", processor.Name, err)
+			return buildAnalytics
+		}
+	}
+	return processed
+}
+
+func runProcessor(processor configs.ProcessorConfigModel, buildAnalytics BuildAnalytics) (BuildAnalytics, error) {
+	payload, err := json.Marshal(buildAnalytics)
+	if err != nil {
+		return BuildAnalytics{}, err
+	}
+
+	envs := append(os.Environ(), buildContextEnvs(buildAnalytics)...)
+	result := runCommand(processor.Command, processor.Args, processor.Timeout, payload, envs)
+	if result.stderr != "" {
+		log.Debugf("[%s] %s", processor.Name, result.stderr)
+	}
+	if result.err != nil {
+		return BuildAnalytics{}, fmt.Errorf("exit code: %d: %s", result.exitCode, result.err)
+	}
+	log.Debugf("Processor %s finished in %s", processor.Name, result.duration.Round(time.Millisecond))
+
+	processed, err := decodeProcessorOutput(result.stdout)
+	if err != nil {
+		return BuildAnalytics{}, fmt.Errorf("invalid output: %s", err)
+	}
+	return processed, nil
+}
+
+// decodeProcessorOutput accepts a single build analytics JSON object without unknown fields.
+func decodeProcessorOutput(output []byte) (BuildAnalytics, error) {
+	if len(bytes.TrimSpace(output)) == 0 {
+		return BuildAnalytics{}, errors.New("empty output")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(output))
+	dec.DisallowUnknownFields()
+
+	var buildAnalytics BuildAnalytics
+	if err := dec.Decode(&buildAnalytics); err != nil {
+		return BuildAnalytics{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return BuildAnalytics{}, errors.New("unexpected data after the build analytics")
+	}
+	if buildAnalytics.Status == "" {
+		return BuildAnalytics{}, errors.New("missing build status")
+	}
+	return buildAnalytics, nil
+}
@@ -0,0 +1,35 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunProcessors(t *testing.T) {
+	redact := configs.ProcessorConfigModel{Name: "redact", Command: "sed", Args: []string{"s/primary/redacted/"}}
+	enrich := configs.ProcessorConfigModel{Name: "enrich", Command: "sed", Args: []string{"s/osx-xcode-12.0.x/macos/"}}
+
+	t.Log("stages modify the payload in order")
+	{
+		processed := RunProcessors([]configs.ProcessorConfigModel{redact, enrich}, testBuildAnalytics)
+		require.Equal(t, "redacted", processed.WorkflowName)
+		require.Equal(t, "macos", processed.StackID)
+		require.Equal(t, testBuildAnalytics.StepAnalytics, processed.StepAnalytics)
+	}
+
+	for _, failing := range []configs.ProcessorConfigModel{
+		{Name: "exit code", Command: "sh", Args: []string{"-c", "cat; exit 1"}},
+		{Name: "empty output", Command: "true"},
+		{Name: "unknown field", Command: "sed", Args: []string{"s/workflow_name/workflow/"}},
+		{Name: "not json", Command: "echo", Args: []string{"redacted"}},
+		{Name: "multiple objects", Command: "sh", Args: []string{"-c", "cat; echo '{}'"}},
+	} {
+		t.Log("falls back to the unmodified payload: " + failing.Name)
+		{
+			processed := RunProcessors([]configs.ProcessorConfigModel{redact, failing}, testBuildAnalytics)
+			require.Equal(t, testBuildAnalytics, processed)
+		}
+	}
+}
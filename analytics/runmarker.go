@@ -0,0 +1,255 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/bitrise-io/bitrise/plugins"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// WillStartRunEvent is the plugin trigger event of the start of a run,
+// the vendored Bitrise CLI only defines plugins.DidFinishRun.
+const WillStartRunEvent plugins.TriggerEventName = "WillStartRun"
+
+const (
+	runMarkersDirName = "run_markers"
+	// buildTriggerTimestampEnvKey is the unix timestamp of the build's trigger.
+	buildTriggerTimestampEnvKey = "BITRISE_BUILD_TRIGGER_TIMESTAMP"
+)
+
+// RunMarker is written to the plugin's data dir when a run starts and removed when it finishes:
+// a marker left behind by a Bitrise CLI process which is no longer running belongs to a build
+// that was killed, timed out or crashed the CLI.
+type RunMarker struct {
+	// ID is the unique ID of the run, its process ID and a random nonce.
+	ID string `json:"id"`
+	// PID is the process ID of the Bitrise CLI running the build.
+	PID          int       `json:"pid"`
+	StartTime    time.Time `json:"start_time"`
+	TriggerTime  time.Time `json:"trigger_time,omitempty"`
+	AppSlug      string    `json:"app_slug,omitempty"`
+	BuildSlug    string    `json:"build_slug,omitempty"`
+	WorkflowName string    `json:"workflow,omitempty"`
+	StackID      string    `json:"stack_id,omitempty"`
+	RepositoryID string    `json:"repo_id,omitempty"`
+	CLIVersion   string    `json:"cli_version,omitempty"`
+
+	pth string
+}
+
+// NewRunMarker reads the known metadata of the starting build, run by the process, from the envs exported by Bitrise.
+func NewRunMarker(startTime time.Time, pid int, getenv func(string) string) (RunMarker, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return RunMarker{}, fmt.Errorf("failed to generate run ID: %s", err)
+	}
+
+	marker := RunMarker{
+		ID:           fmt.Sprintf("%d-%s", pid, hex.EncodeToString(nonce)),
+		PID:          pid,
+		StartTime:    startTime,
+		AppSlug:      getenv(appSlugEnvKey),
+		BuildSlug:    getenv(buildSlugEnvKey),
+		WorkflowName: getenv(workflowName),
+		StackID:      getenv(stackIDEnvKey),
+		RepositoryID: getenv(repoSlug),
+		CLIVersion:   getenv(plugins.PluginConfigBitriseVersionKey),
+	}
+	if timestamp, err := strconv.ParseInt(getenv(buildTriggerTimestampEnvKey), 10, 64); err == nil && timestamp > 0 {
+		marker.TriggerTime = time.Unix(timestamp, 0)
+	}
+	return marker, nil
+}
+
+// RunProcessID returns the process ID of the Bitrise CLI running the plugin.
+// The CLI runs the plugin with envman, so the CLI is the plugin's grandparent process:
+// it is the same process at the start and at the end of the run, and a different one for nested runs.
+func RunProcessID() (int, error) {
+	out, err := exec.Command("ps", "-o", "ppid=", "-p", strconv.Itoa(os.Getppid())).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the parent process of %d: %s", os.Getppid(), err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid process ID (%s): %s", out, err)
+	}
+	return pid, nil
+}
+
+// ProcessAlive tells whether the process is running.
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+func runMarkersDir() (string, error) {
+	if configs.DataDir == "" {
+		return "", errors.New("plugin data dir is not set")
+	}
+	return filepath.Join(configs.DataDir, runMarkersDirName), nil
+}
+
+// WriteRunMarker ...
+func WriteRunMarker(marker RunMarker) error {
+	dir, err := runMarkersDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	name := marker.ID
+	if name == "" {
+		name = strconv.FormatInt(marker.StartTime.UnixNano(), 10)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, name+".json"), content, 0644)
+}
+
+// ReadRunMarkers returns the markers in the data dir, ordered by their start time.
+func ReadRunMarkers() ([]RunMarker, error) {
+	dir, err := runMarkersDir()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var markers []RunMarker
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		pth := filepath.Join(dir, file.Name())
+
+		var marker RunMarker
+		content, err := ioutil.ReadFile(pth)
+		if err == nil {
+			err = json.Unmarshal(content, &marker)
+		}
+		if err != nil {
+			log.Warnf("Removing invalid run marker (%s): %s", file.Name(), err)
+			if err := os.Remove(pth); err != nil {
+				log.Warnf("Failed to remove run marker: %s", err)
+			}
+			continue
+		}
+		marker.pth = pth
+		markers = append(markers, marker)
+	}
+
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].StartTime.Before(markers[j].StartTime)
+	})
+	return markers, nil
+}
+
+// Remove ...
+func (m RunMarker) Remove() error {
+	if m.pth == "" {
+		return fmt.Errorf("run marker of %s was not read from the data dir", m.StartTime)
+	}
+	return os.Remove(m.pth)
+}
+
+// AbortedBuildAnalytics returns the build analytics of the marker's build, which never finished.
+func (m RunMarker) AbortedBuildAnalytics() BuildAnalytics {
+	return BuildAnalytics{
+		BuildAnalytics: analyticsModels.BuildAnalytics{
+			StartTime:    m.StartTime,
+			AppSlug:      m.AppSlug,
+			BuildSlug:    m.BuildSlug,
+			WorkflowName: m.WorkflowName,
+			StackID:      m.StackID,
+			RepositoryID: m.RepositoryID,
+			CLIVersion:   m.CLIVersion,
+			Status:       buildStatusAborted,
+		},
+		QueueTime: m.queueTime(),
+	}
+}
+
+func (m RunMarker) queueTime() *time.Duration {
+	if m.TriggerTime.IsZero() || m.TriggerTime.After(m.StartTime) {
+		return nil
+	}
+	queueTime := m.StartTime.Sub(m.TriggerTime)
+	return &queueTime
+}
+
+// SplitRunMarkers returns the marker of the run of the process and the orphaned markers,
+// the markers of other processes which are no longer running.
+// The run's marker is the most recent marker of the process: older ones belong to
+// a finished process which had the same process ID, so they are orphaned too.
+// The marker of the run is nil if the CLI did not trigger the plugin at the start of the run.
+func SplitRunMarkers(markers []RunMarker, pid int, alive func(pid int) bool) (*RunMarker, []RunMarker) {
+	own := -1
+	for i := len(markers) - 1; i >= 0; i-- {
+		if markers[i].PID == pid {
+			own = i
+			break
+		}
+	}
+
+	var orphans []RunMarker
+	for i, marker := range markers {
+		if i == own {
+			continue
+		}
+		if marker.PID == pid || !alive(marker.PID) {
+			orphans = append(orphans, marker)
+		}
+	}
+
+	if own < 0 {
+		return nil, orphans
+	}
+	return &markers[own], orphans
+}
+
+// MeasureRunOverhead sets the build's queue time, from its trigger to the start of the run,
+// and its startup overhead, from the start of the run to the start of its first step.
+func MeasureRunOverhead(buildAnalytics *BuildAnalytics, marker RunMarker) {
+	buildAnalytics.QueueTime = marker.queueTime()
+
+	if len(buildAnalytics.StepAnalytics) == 0 {
+		return
+	}
+	firstStepStart := buildAnalytics.StepAnalytics[0].StartTime
+	if firstStepStart.IsZero() || firstStepStart.Before(marker.StartTime) {
+		return
+	}
+	startupOverhead := firstStepStart.Sub(marker.StartTime)
+	buildAnalytics.StartupOverhead = &startupOverhead
+}
@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRunMarker(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	envs := map[string]string{
+		"BITRISE_APP_SLUG":                 "app-slug",
+		"BITRISE_BUILD_SLUG":               "build-slug",
+		"BITRISE_TRIGGERED_WORKFLOW_TITLE": "primary",
+		"BITRISE_BUILD_TRIGGER_TIMESTAMP":  "1601553540",
+	}
+	marker, err := NewRunMarker(start, 42, func(key string) string { return envs[key] })
+	require.NoError(t, err)
+	require.Regexp(t, "^42-[0-9a-f]{16}$", marker.ID)
+
+	other, err := NewRunMarker(start, 42, func(key string) string { return envs[key] })
+	require.NoError(t, err)
+	require.NotEqual(t, marker.ID, other.ID)
+
+	require.Equal(t, RunMarker{
+		ID:           marker.ID,
+		PID:          42,
+		StartTime:    start,
+		TriggerTime:  time.Unix(1601553540, 0),
+		AppSlug:      "app-slug",
+		BuildSlug:    "build-slug",
+		WorkflowName: "primary",
+	}, marker)
+
+	aborted := marker.AbortedBuildAnalytics()
+	require.Equal(t, "aborted", aborted.Status)
+	require.Equal(t, "primary", aborted.WorkflowName)
+	require.Equal(t, durationPtr(time.Minute), aborted.QueueTime)
+}
+
+func TestRunMarkers(t *testing.T) {
+	dataDir, err := pathutil.NormalizedOSTempDirPath("data")
+	require.NoError(t, err)
+	configs.DataDir = dataDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	markers, err := ReadRunMarkers()
+	require.NoError(t, err)
+	require.Empty(t, markers)
+
+	// the finished run is process 1, process 2 is still running, process 3 was killed
+	alive := func(pid int) bool { return pid == 1 || pid == 2 }
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, WriteRunMarker(RunMarker{ID: "1-b", PID: 1, StartTime: start.Add(time.Hour), BuildSlug: "finished"}))
+	require.NoError(t, WriteRunMarker(RunMarker{ID: "3-a", PID: 3, StartTime: start, BuildSlug: "killed"}))
+	require.NoError(t, WriteRunMarker(RunMarker{ID: "2-a", PID: 2, StartTime: start.Add(2 * time.Hour), BuildSlug: "running"}))
+	require.NoError(t, WriteRunMarker(RunMarker{ID: "2-b", PID: 2, StartTime: start.Add(3 * time.Hour), BuildSlug: "nested"}))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "run_markers", "invalid.json"), []byte("{"), 0644))
+
+	markers, err = ReadRunMarkers()
+	require.NoError(t, err)
+	require.Equal(t, 4, len(markers))
+
+	buildAnalytics := BuildAnalytics{
+		StepAnalytics: []StepAnalytics{
+			{StepAnalytics: analyticsModels.StepAnalytics{StartTime: start.Add(time.Hour + 30*time.Second)}},
+		},
+	}
+	marker, orphans := SplitRunMarkers(markers, 1, alive)
+	require.NotNil(t, marker)
+	require.Equal(t, "finished", marker.BuildSlug)
+	require.Equal(t, 1, len(orphans))
+	require.Equal(t, "killed", orphans[0].BuildSlug)
+
+	MeasureRunOverhead(&buildAnalytics, *marker)
+	require.Equal(t, durationPtr(30*time.Second), buildAnalytics.StartupOverhead)
+	require.Nil(t, buildAnalytics.QueueTime)
+
+	require.NoError(t, marker.Remove())
+	require.NoError(t, orphans[0].Remove())
+	markers, err = ReadRunMarkers()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(markers))
+
+	// the older marker of a process is left behind by a finished process with the same process ID
+	marker, orphans = SplitRunMarkers(markers, 2, alive)
+	require.NotNil(t, marker)
+	require.Equal(t, "nested", marker.BuildSlug)
+	require.Equal(t, 1, len(orphans))
+	require.Equal(t, "running", orphans[0].BuildSlug)
+
+	// the markers of running processes are not orphaned
+	marker, orphans = SplitRunMarkers(markers, 4, alive)
+	require.Nil(t, marker)
+	require.Empty(t, orphans)
+}
+
+func TestProcessAlive(t *testing.T) {
+	require.True(t, ProcessAlive(os.Getpid()))
+	require.False(t, ProcessAlive(0))
+}
@@ -0,0 +1,51 @@
+package analytics
+
+import "time"
+
+// measureWallClock sets the build's wall-clock runtime, from the build's start to the end of its last step,
+// its overhead, the wall-clock time spent outside of the steps, and the gap before each step's start.
+// Nothing is set for builds or steps without start time, as reported by older Bitrise CLIs.
+func measureWallClock(buildAnalytics *BuildAnalytics) {
+	if buildAnalytics.StartTime.IsZero() {
+		return
+	}
+
+	var (
+		end      time.Time
+		stepTime time.Duration
+		// previousEnd is unknown after a step without start time
+		previousEnd = buildAnalytics.StartTime
+	)
+	for i := range buildAnalytics.StepAnalytics {
+		step := &buildAnalytics.StepAnalytics[i]
+		stepTime += step.Runtime
+
+		if step.StartTime.IsZero() {
+			previousEnd = time.Time{}
+			continue
+		}
+
+		if !previousEnd.IsZero() {
+			gap := step.StartTime.Sub(previousEnd)
+			if gap < 0 {
+				gap = 0
+			}
+			step.GapBeforeStart = &gap
+		}
+
+		previousEnd = step.StartTime.Add(step.Runtime)
+		if previousEnd.After(end) {
+			end = previousEnd
+		}
+	}
+	if end.IsZero() {
+		return
+	}
+
+	buildAnalytics.WallClockRuntime = end.Sub(buildAnalytics.StartTime)
+	overhead := buildAnalytics.WallClockRuntime - stepTime
+	if overhead < 0 {
+		overhead = 0
+	}
+	buildAnalytics.Overhead = &overhead
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestMeasureWallClock(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	step := func(startOffset, runtime time.Duration) StepAnalytics {
+		stepAnalytics := StepAnalytics{StepAnalytics: analyticsModels.StepAnalytics{Runtime: runtime}}
+		if startOffset >= 0 {
+			stepAnalytics.StartTime = start.Add(startOffset)
+		}
+		return stepAnalytics
+	}
+
+	tests := []struct {
+		name          string
+		buildStart    time.Time
+		steps         []StepAnalytics
+		wantWallClock time.Duration
+		wantOverhead  *time.Duration
+		wantGaps      []*time.Duration
+	}{
+		{
+			name:          "gaps between steps",
+			buildStart:    start,
+			steps:         []StepAnalytics{step(10*time.Second, 20*time.Second), step(35*time.Second, 5*time.Second)},
+			wantWallClock: 40 * time.Second,
+			wantOverhead:  durationPtr(15 * time.Second),
+			wantGaps:      []*time.Duration{durationPtr(10 * time.Second), durationPtr(5 * time.Second)},
+		},
+		{
+			name:          "step without start time",
+			buildStart:    start,
+			steps:         []StepAnalytics{step(0, 10*time.Second), step(-1, 10*time.Second), step(25*time.Second, 5*time.Second)},
+			wantWallClock: 30 * time.Second,
+			wantOverhead:  durationPtr(5 * time.Second),
+			wantGaps:      []*time.Duration{durationPtr(0), nil, nil},
+		},
+		{
+			name:          "overlapping steps",
+			buildStart:    start,
+			steps:         []StepAnalytics{step(0, 10*time.Second), step(5*time.Second, 10*time.Second)},
+			wantWallClock: 15 * time.Second,
+			wantOverhead:  durationPtr(0),
+			wantGaps:      []*time.Duration{durationPtr(0), durationPtr(0)},
+		},
+		{
+			name:     "build without start time",
+			steps:    []StepAnalytics{step(0, 10*time.Second)},
+			wantGaps: []*time.Duration{nil},
+		},
+		{
+			name:       "build without steps",
+			buildStart: start,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildAnalytics := BuildAnalytics{
+				BuildAnalytics: analyticsModels.BuildAnalytics{StartTime: tt.buildStart},
+				StepAnalytics:  tt.steps,
+			}
+			measureWallClock(&buildAnalytics)
+
+			require.Equal(t, tt.wantWallClock, buildAnalytics.WallClockRuntime)
+			require.Equal(t, tt.wantOverhead, buildAnalytics.Overhead)
+			var gaps []*time.Duration
+			for _, step := range buildAnalytics.StepAnalytics {
+				gaps = append(gaps, step.GapBeforeStart)
+			}
+			require.Equal(t, tt.wantGaps, gaps)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+)
+
+// Sink receives the build analytics in addition to the analytics collector.
+type Sink interface {
+	Name() string
+	Send(buildAnalytics BuildAnalytics) error
+}
+
+// SinksFromConfig returns the sinks enabled in the plugin config.
+func SinksFromConfig(config configs.ConfigModel) []Sink {
+	var sinks []Sink
+	if config.StatsD != nil {
+		sinks = append(sinks, NewStatsDSink(*config.StatsD))
+	}
+	if config.InfluxDB != nil {
+		sinks = append(sinks, NewInfluxDBSink(*config.InfluxDB))
+	}
+	if config.Elasticsearch != nil {
+		sinks = append(sinks, NewElasticsearchSink(*config.Elasticsearch))
+	}
+	if config.Syslog != nil {
+		sinks = append(sinks, NewSyslogSink(*config.Syslog))
+	}
+	for _, webhook := range config.Webhooks {
+		sinks = append(sinks, NewWebhookSink(webhook))
+	}
+	return sinks
+}
+
+// SinkByName returns the configured sink of the name: statsd, influxdb, elasticsearch, syslog or webhook:WEBHOOK_NAME.
+func SinkByName(config configs.ConfigModel, name string) (Sink, error) {
+	if webhookName := strings.TrimPrefix(name, "webhook:"); webhookName != name {
+		for _, webhook := range config.Webhooks {
+			if webhook.Name == webhookName {
+				return NewWebhookSink(webhook), nil
+			}
+		}
+		return nil, fmt.Errorf("webhook not found in the configuration: %s", webhookName)
+	}
+
+	for _, sink := range SinksFromConfig(config) {
+		if sink.Name() == name {
+			return sink, nil
+		}
+	}
+	return nil, fmt.Errorf("sink not configured: %s (options: statsd, influxdb, elasticsearch, syslog, webhook:WEBHOOK_NAME)", name)
+}
+
+// ExportToSink sends the builds to the sink, at most concurrency builds at a time,
+// it returns the error of each build, nil for the builds sent.
+func ExportToSink(sink Sink, builds []BuildAnalytics, concurrency int) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		errs      = make([]error, len(builds))
+		wg        sync.WaitGroup
+		semaphore = make(chan bool, concurrency)
+	)
+	for i, buildAnalytics := range builds {
+		wg.Add(1)
+		semaphore <- true
+		go func(i int, buildAnalytics BuildAnalytics) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			errs[i] = sink.Send(buildAnalytics)
+		}(i, buildAnalytics)
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,164 @@
+package analytics
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+)
+
+const (
+	defaultStatsDAddress = "127.0.0.1:8125"
+	// statsDMaxPacketSize keeps a single datagram below the common Ethernet MTU.
+	statsDMaxPacketSize = 1432
+	statsDTimeout       = time.Second
+)
+
+// StatsDSink emits build and step timings and step status counters
+// to a StatsD agent over UDP, tagged in the DogStatsD format.
+type StatsDSink struct {
+	address    string
+	prefix     string
+	sampleRate float64
+	sample     func() float64
+}
+
+// NewStatsDSink ...
+func NewStatsDSink(config configs.StatsDConfigModel) StatsDSink {
+	sink := StatsDSink{
+		address:    config.Address,
+		prefix:     config.Prefix,
+		sampleRate: config.SampleRate,
+		sample:     rand.Float64,
+	}
+	if sink.address == "" {
+		sink.address = defaultStatsDAddress
+	}
+	if sink.sampleRate <= 0 || sink.sampleRate > 1 {
+		sink.sampleRate = 1
+	}
+	return sink
+}
+
+// Name ...
+func (s StatsDSink) Name() string {
+	return "statsd"
+}
+
+// Send writes the metrics without waiting for the agent: UDP writes do not block
+// on an unavailable agent and the dial and write deadlines bound the rest.
+func (s StatsDSink) Send(buildAnalytics BuildAnalytics) error {
+	metrics := s.metrics(buildAnalytics)
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("udp", s.address, statsDTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd agent (%s): %s", s.address, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(statsDTimeout)); err != nil {
+		return err
+	}
+
+	for _, packet := range statsDPackets(metrics) {
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("failed to write statsd metrics (%s): %s", s.address, err)
+		}
+	}
+	return nil
+}
+
+func (s StatsDSink) metrics(buildAnalytics BuildAnalytics) []string {
+	buildTags := []string{
+		statsDTag("workflow", buildAnalytics.WorkflowName),
+		statsDTag("stack_id", buildAnalytics.StackID),
+		statsDTag("platform", buildAnalytics.Platform),
+	}
+	for _, key := range sortedLabelKeys(buildAnalytics.Labels) {
+		buildTags = append(buildTags, statsDTag("label_"+key, buildAnalytics.Labels[key]))
+	}
+
+	var metrics []string
+	if s.sampled() {
+		metrics = append(metrics, s.metric("build.runtime", durationMillis(buildAnalytics.Runtime), "ms",
+			append(buildTags, statsDTag("status", buildAnalytics.Status))))
+	}
+
+	for _, step := range buildAnalytics.StepAnalytics {
+		stepTags := append([]string{
+			statsDTag("step_id", step.StepID),
+			statsDTag("step_version", step.StepVersion),
+		}, buildTags...)
+
+		if s.sampled() {
+			metrics = append(metrics, s.metric("step.runtime", durationMillis(step.Runtime), "ms", stepTags))
+		}
+		if s.sampled() {
+			metrics = append(metrics, s.metric("step.status."+step.Status, "1", "c", stepTags))
+		}
+		// gauges are not sampled
+		for _, stepMetric := range step.Metrics {
+			metrics = append(metrics, s.metric("step.metric."+stepMetric.Name, strconv.FormatFloat(stepMetric.Value, 'f', -1, 64), "g", stepTags))
+		}
+	}
+	return metrics
+}
+
+func (s StatsDSink) sampled() bool {
+	return s.sampleRate >= 1 || s.sample() < s.sampleRate
+}
+
+func (s StatsDSink) metric(name, value, metricType string, tags []string) string {
+	metric := s.prefix + name + ":" + value + "|" + metricType
+	if s.sampleRate < 1 && metricType != "g" {
+		metric += "|@" + strconv.FormatFloat(s.sampleRate, 'f', -1, 64)
+	}
+	if len(tags) > 0 {
+		metric += "|#" + strings.Join(tags, ",")
+	}
+	return metric
+}
+
+func statsDPackets(metrics []string) [][]byte {
+	var (
+		packets [][]byte
+		packet  bytes.Buffer
+	)
+	for _, metric := range metrics {
+		if packet.Len() > 0 && packet.Len()+1+len(metric) > statsDMaxPacketSize {
+			packets = append(packets, append([]byte{}, packet.Bytes()...))
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(metric)
+	}
+	if packet.Len() > 0 {
+		packets = append(packets, packet.Bytes())
+	}
+	return packets
+}
+
+func durationMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+var statsDTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func statsDTag(key, value string) string {
+	if value == "" {
+		value = "unknown"
+	}
+	return key + ":" + statsDTagReplacer.Replace(value)
+}
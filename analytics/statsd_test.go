@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/stretchr/testify/require"
+)
+
+var testBuildAnalytics = BuildAnalytics{
+	BuildAnalytics: analyticsModels.BuildAnalytics{
+		StackID:      "osx-xcode-12.0.x",
+		Platform:     "ios",
+		WorkflowName: "primary",
+		Status:       "failed",
+		Runtime:      3 * time.Second,
+	},
+	StepAnalytics: []StepAnalytics{
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "script", StepVersion: "1.1.3", Status: "success", Runtime: 1500 * time.Millisecond}, Idx: 0},
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test", StepVersion: "2.4.0", Status: "failed", Runtime: 1500 * time.Millisecond}, Idx: 1},
+	},
+}
+
+func TestStatsDSinkMetrics(t *testing.T) {
+	sink := NewStatsDSink(configs.StatsDConfigModel{Prefix: "bitrise."})
+
+	require.Equal(t, []string{
+		"bitrise.build.runtime:3000|ms|#workflow:primary,stack_id:osx-xcode-12.0.x,platform:ios,status:failed",
+		"bitrise.step.runtime:1500|ms|#step_id:script,step_version:1.1.3,workflow:primary,stack_id:osx-xcode-12.0.x,platform:ios",
+		"bitrise.step.status.success:1|c|#step_id:script,step_version:1.1.3,workflow:primary,stack_id:osx-xcode-12.0.x,platform:ios",
+		"bitrise.step.runtime:1500|ms|#step_id:xcode-test,step_version:2.4.0,workflow:primary,stack_id:osx-xcode-12.0.x,platform:ios",
+		"bitrise.step.status.failed:1|c|#step_id:xcode-test,step_version:2.4.0,workflow:primary,stack_id:osx-xcode-12.0.x,platform:ios",
+	}, sink.metrics(testBuildAnalytics))
+}
+
+func TestStatsDSinkSampleRate(t *testing.T) {
+	sink := NewStatsDSink(configs.StatsDConfigModel{SampleRate: 0.5})
+
+	sink.sample = func() float64 { return 0.9 }
+	require.Empty(t, sink.metrics(testBuildAnalytics))
+
+	sink.sample = func() float64 { return 0.1 }
+	metrics := sink.metrics(testBuildAnalytics)
+	require.Len(t, metrics, 5)
+	require.True(t, strings.HasPrefix(metrics[0], "build.runtime:3000|ms|@0.5|#"), metrics[0])
+}
+
+func TestStatsDSinkSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	sink := NewStatsDSink(configs.StatsDConfigModel{Address: conn.LocalAddr().String()})
+	require.NoError(t, sink.Send(testBuildAnalytics))
+
+	buf := make([]byte, statsDMaxPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(sink.metrics(testBuildAnalytics), "\n"), string(buf[:n]))
+}
+
+func TestStatsDSinkDoesNotFailWithoutAgent(t *testing.T) {
+	sink := NewStatsDSink(configs.StatsDConfigModel{Address: "127.0.0.1:1"})
+	require.NoError(t, sink.Send(testBuildAnalytics))
+}
@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"github.com/bitrise-io/bitrise/models"
+)
+
+// Step run status codes emitted by current Bitrise CLIs but not defined by the vendored models.
+const (
+	stepRunStatusCodePreparationFailed   = 5
+	stepRunStatusCodeAbortedWithTimeout  = 7
+	stepRunStatusCodeAbortedWithNoOutput = 8
+)
+
+// Step statuses
+const (
+	stepStatusSuccess             = "success"
+	stepStatusFailed              = "failed"
+	stepStatusFailedSkippable     = "failed_skippable"
+	stepStatusSkipped             = "skipped"
+	stepStatusSkippedWithRunIf    = "skipped_with_runif"
+	stepStatusPreparationFailed   = "preparation_failed"
+	stepStatusAbortedWithTimeout  = "aborted_with_timeout"
+	stepStatusAbortedWithNoOutput = "aborted_with_no_output"
+	stepStatusUnknown             = "unknown"
+)
+
+// Build statuses
+const (
+	buildStatusSuccessful          = "successful"
+	buildStatusFailed              = "failed"
+	buildStatusFailedSkippableOnly = "failed_skippable_only"
+	buildStatusAborted             = "aborted"
+)
+
+// stepStatuses maps the step run status codes of the Bitrise CLI to the reported step statuses.
+var stepStatuses = []struct {
+	code   int
+	status string
+	failed bool
+}{
+	{models.StepRunStatusCodeSuccess, stepStatusSuccess, false},
+	{models.StepRunStatusCodeFailed, stepStatusFailed, true},
+	{models.StepRunStatusCodeFailedSkippable, stepStatusFailedSkippable, false},
+	{models.StepRunStatusCodeSkipped, stepStatusSkipped, false},
+	{models.StepRunStatusCodeSkippedWithRunIf, stepStatusSkippedWithRunIf, false},
+	{stepRunStatusCodePreparationFailed, stepStatusPreparationFailed, true},
+	{stepRunStatusCodeAbortedWithTimeout, stepStatusAbortedWithTimeout, true},
+	{stepRunStatusCodeAbortedWithNoOutput, stepStatusAbortedWithNoOutput, true},
+}
+
+// stepStatus returns the step status of the status code, unknown codes are reported
+// as unknown and are kept in the step's status code.
+func stepStatus(code int) string {
+	for _, s := range stepStatuses {
+		if s.code == code {
+			return s.status
+		}
+	}
+	return stepStatusUnknown
+}
+
+// isFailedStepStatus tells whether the step failed the build.
+func isFailedStepStatus(status string) bool {
+	for _, s := range stepStatuses {
+		if s.status == status {
+			return s.failed
+		}
+	}
+	return false
+}
+
+// buildStatus returns the build's status: failed if a step failed the build,
+// failed_skippable_only if only steps marked as skippable failed, successful otherwise.
+func buildStatus(buildRunResults models.BuildRunResultsModel) string {
+	switch {
+	case buildRunResults.IsBuildFailed():
+		return buildStatusFailed
+	case buildRunResults.HasFailedSkippableSteps():
+		return buildStatusFailedSkippableOnly
+	default:
+		return buildStatusSuccessful
+	}
+}
+
+// isFailedBuildStatus tells whether the build failed or was aborted.
+func isFailedBuildStatus(status string) bool {
+	return status == buildStatusFailed || status == buildStatusAborted
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/bitrise/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepStatus(t *testing.T) {
+	tests := []struct {
+		code       int
+		wantStatus string
+		wantFailed bool
+	}{
+		{models.StepRunStatusCodeSuccess, "success", false},
+		{models.StepRunStatusCodeFailed, "failed", true},
+		{models.StepRunStatusCodeFailedSkippable, "failed_skippable", false},
+		{models.StepRunStatusCodeSkipped, "skipped", false},
+		{models.StepRunStatusCodeSkippedWithRunIf, "skipped_with_runif", false},
+		{5, "preparation_failed", true},
+		{7, "aborted_with_timeout", true},
+		{8, "aborted_with_no_output", true},
+		{6, "unknown", false},
+		{42, "unknown", false},
+	}
+	for _, tt := range tests {
+		status := stepStatus(tt.code)
+		require.Equal(t, tt.wantStatus, status, "code: %d", tt.code)
+		require.Equal(t, tt.wantFailed, isFailedStepStatus(status), "code: %d", tt.code)
+	}
+}
+
+func TestStepStatusesAreUnique(t *testing.T) {
+	codes := map[int]bool{}
+	statuses := map[string]bool{}
+	for _, s := range stepStatuses {
+		require.False(t, codes[s.code], "duplicated code: %d", s.code)
+		require.False(t, statuses[s.status], "duplicated status: %s", s.status)
+		codes[s.code] = true
+		statuses[s.status] = true
+	}
+}
+
+func TestBuildStatus(t *testing.T) {
+	step := models.StepRunResultsModel{}
+
+	tests := []struct {
+		name            string
+		buildRunResults models.BuildRunResultsModel
+		want            string
+	}{
+		{"no steps", models.BuildRunResultsModel{}, "successful"},
+		{"successful", models.BuildRunResultsModel{SuccessSteps: []models.StepRunResultsModel{step}}, "successful"},
+		{"failed skippable only", models.BuildRunResultsModel{
+			SuccessSteps:         []models.StepRunResultsModel{step},
+			FailedSkippableSteps: []models.StepRunResultsModel{step},
+		}, "failed_skippable_only"},
+		{"failed", models.BuildRunResultsModel{
+			FailedSteps:          []models.StepRunResultsModel{step},
+			FailedSkippableSteps: []models.StepRunResultsModel{step},
+		}, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, buildStatus(tt.buildRunResults))
+		})
+	}
+}
+
+func TestNewBuildAnalyticsKeepsStatusCodes(t *testing.T) {
+	buildRunResults := models.BuildRunResultsModel{
+		FailedSteps: []models.StepRunResultsModel{
+			{Idx: 0, Status: 7},
+			{Idx: 1, Status: 42},
+		},
+	}
+	buildAnalytics := NewBuildAnalytics(BuildRunResults{BuildRunResultsModel: buildRunResults})
+	require.Equal(t, "failed", buildAnalytics.Status)
+	require.Equal(t, "aborted_with_timeout", buildAnalytics.StepAnalytics[0].Status)
+	require.Equal(t, 7, buildAnalytics.StepAnalytics[0].StatusCode)
+	require.Equal(t, "unknown", buildAnalytics.StepAnalytics[1].Status)
+	require.Equal(t, 42, buildAnalytics.StepAnalytics[1].StatusCode)
+}
@@ -0,0 +1,236 @@
+package analytics
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/bitrise-plugins-analytics/version"
+)
+
+const (
+	defaultSyslogSocket  = "/dev/log"
+	defaultSyslogAppName = "bitrise-analytics"
+	syslogTimeout        = 5 * time.Second
+	syslogSoftware       = "bitrise-plugins-analytics"
+)
+
+// syslogEnterpriseIDPattern matches private enterprise numbers, optionally with sub-identifiers.
+var syslogEnterpriseIDPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslog severities by build status
+var syslogSeverities = map[string]int{
+	buildStatusSuccessful:          6, // informational
+	buildStatusFailedSkippableOnly: 4, // warning
+	buildStatusFailed:              3, // error
+	buildStatusAborted:             3, // error
+}
+
+const syslogDefaultSeverity = 5 // notice
+
+// SyslogSink emits one RFC 5424 message per build, with the failed steps as structured data.
+type SyslogSink struct {
+	network      string
+	address      string
+	facility     string
+	appName      string
+	enterpriseID string
+	hostname     string
+	now          func() time.Time
+}
+
+// NewSyslogSink ...
+func NewSyslogSink(config configs.SyslogConfigModel) SyslogSink {
+	sink := SyslogSink{
+		network:      config.Network,
+		address:      config.Address,
+		facility:     config.Facility,
+		appName:      config.AppName,
+		enterpriseID: config.EnterpriseID,
+		now:          time.Now,
+	}
+	if sink.network == "" {
+		sink.network = "unix"
+	}
+	if sink.address == "" && sink.network == "unix" {
+		sink.address = defaultSyslogSocket
+	}
+	if sink.facility == "" {
+		sink.facility = "user"
+	}
+	if sink.appName == "" {
+		sink.appName = defaultSyslogAppName
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		sink.hostname = hostname
+	}
+	return sink
+}
+
+// Name ...
+func (s SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Send ...
+func (s SyslogSink) Send(buildAnalytics BuildAnalytics) error {
+	message, err := s.message(buildAnalytics)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog (%s %s): %s", s.network, s.address, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(syslogTimeout)); err != nil {
+		return err
+	}
+
+	if s.network == "tcp" {
+		// octet-counting framing (RFC 6587)
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return fmt.Errorf("failed to write syslog message: %s", err)
+	}
+	return nil
+}
+
+func (s SyslogSink) dial() (net.Conn, error) {
+	switch s.network {
+	case "unix":
+		// syslog daemons listen on datagram sockets, some on stream ones
+		conn, err := net.DialTimeout("unixgram", s.address, syslogTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		return net.DialTimeout("unix", s.address, syslogTimeout)
+	case "udp", "tcp":
+		return net.DialTimeout(s.network, s.address, syslogTimeout)
+	default:
+		return nil, fmt.Errorf("unknown network: %s (options: unix, udp, tcp)", s.network)
+	}
+}
+
+func (s SyslogSink) message(buildAnalytics BuildAnalytics) (string, error) {
+	facility, ok := syslogFacilities[s.facility]
+	if !ok {
+		return "", fmt.Errorf("unknown facility: %s", s.facility)
+	}
+
+	severity, ok := syslogSeverities[buildAnalytics.Status]
+	if !ok {
+		severity = syslogDefaultSeverity
+	}
+
+	msg := fmt.Sprintf("Build of workflow %s %s in %s", buildAnalytics.WorkflowName, buildAnalytics.Status, buildAnalytics.Runtime.Round(time.Second))
+
+	structuredData, err := s.structuredData(buildAnalytics)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		facility*8+severity,
+		s.now().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.appName, 48),
+		os.Getpid(),
+		syslogHeaderField(buildAnalytics.Event(), 32),
+		structuredData,
+		msg,
+	), nil
+}
+
+// structuredData returns the registered origin element, followed by the build's details and its failed steps
+// if the enterprise ID of their IDs is configured.
+func (s SyslogSink) structuredData(buildAnalytics BuildAnalytics) (string, error) {
+	structuredData := "[origin" + syslogSDParams([][2]string{
+		{"software", syslogSoftware},
+		{"swVersion", version.VERSION},
+	}) + "]"
+	if s.enterpriseID == "" {
+		return structuredData, nil
+	}
+	if !syslogEnterpriseIDPattern.MatchString(s.enterpriseID) {
+		return "", fmt.Errorf("invalid enterprise id: %s", s.enterpriseID)
+	}
+
+	structuredData += s.sdElement("build", [][2]string{
+		{"app_slug", buildAnalytics.AppSlug},
+		{"build_slug", buildAnalytics.BuildSlug},
+		{"workflow", buildAnalytics.WorkflowName},
+		{"stack_id", buildAnalytics.StackID},
+		{"platform", buildAnalytics.Platform},
+		{"status", buildAnalytics.Status},
+		{"run_time_ms", strconv.FormatInt(int64(buildAnalytics.Runtime/time.Millisecond), 10)},
+		{"step_count", strconv.Itoa(len(buildAnalytics.StepAnalytics))},
+	})
+
+	if len(buildAnalytics.Labels) > 0 {
+		var labels [][2]string
+		for _, key := range sortedLabelKeys(buildAnalytics.Labels) {
+			labels = append(labels, [2]string{key, buildAnalytics.Labels[key]})
+		}
+		structuredData += s.sdElement("labels", labels)
+	}
+
+	var failedSteps [][2]string
+	for _, step := range buildAnalytics.StepAnalytics {
+		if isFailedStepStatus(step.Status) {
+			failedSteps = append(failedSteps, [2]string{"step", step.StepID + "@" + step.StepVersion})
+		}
+	}
+	if len(failedSteps) > 0 {
+		structuredData += s.sdElement("failed_steps", failedSteps)
+	}
+	return structuredData, nil
+}
+
+// syslogHeaderField returns the field as printable US-ASCII of the allowed length, or the NILVALUE.
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+var syslogParamValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// sdElement returns the structured data element of the ID, qualified with the enterprise ID.
+func (s SyslogSink) sdElement(id string, params [][2]string) string {
+	return "[" + id + "@" + s.enterpriseID + syslogSDParams(params) + "]"
+}
+
+func syslogSDParams(params [][2]string) string {
+	var sdParams string
+	for _, param := range params {
+		sdParams += " " + param[0] + `="` + syslogParamValueEscaper.Replace(param[1]) + `"`
+	}
+	return sdParams
+}
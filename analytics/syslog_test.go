@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/bitrise-plugins-analytics/version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogSinkMessage(t *testing.T) {
+	sink := NewSyslogSink(configs.SyslogConfigModel{Facility: "local0", AppName: "bitrise analytics", EnterpriseID: "32473"})
+	sink.hostname = "mac-mini"
+	sink.now = func() time.Time {
+		return time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	}
+
+	buildAnalytics := testBuildAnalytics
+	buildAnalytics.BuildSlug = `slug"]`
+
+	message, err := sink.message(buildAnalytics)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(`<131>1 2020-03-15T10:00:00.000000Z mac-mini bitriseanalytics %d build_finished `, os.Getpid())+
+		`[origin software="bitrise-plugins-analytics" swVersion="`+version.VERSION+`"]`+
+		`[build@32473 app_slug="" build_slug="slug\"\]" workflow="primary" stack_id="osx-xcode-12.0.x" platform="ios" status="failed" run_time_ms="3000" step_count="2"]`+
+		`[failed_steps@32473 step="xcode-test@2.4.0"] Build of workflow primary failed in 3s`, message)
+
+	buildAnalytics.Status = "successful"
+	message, err = sink.message(buildAnalytics)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(message, "<134>1 "), message)
+
+	_, err = NewSyslogSink(configs.SyslogConfigModel{Facility: "local9"}).message(buildAnalytics)
+	require.Error(t, err)
+
+	_, err = NewSyslogSink(configs.SyslogConfigModel{EnterpriseID: "bitrise"}).message(buildAnalytics)
+	require.Error(t, err)
+
+	// without enterprise id only the registered origin element is sent
+	sink.enterpriseID = ""
+	message, err = sink.message(buildAnalytics)
+	require.NoError(t, err)
+	require.Contains(t, message, ` build_finished [origin software="bitrise-plugins-analytics" swVersion="`+version.VERSION+`"] Build of workflow primary successful in 3s`)
+}
+
+func TestSyslogSinkSendTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, listener.Close())
+	}()
+
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		r := bufio.NewReader(conn)
+		length, err := r.ReadString(' ')
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		message := make([]byte, n)
+		if _, err := io.ReadFull(r, message); err != nil {
+			received <- err.Error()
+			return
+		}
+		received <- string(message)
+	}()
+
+	sink := NewSyslogSink(configs.SyslogConfigModel{Network: "tcp", Address: listener.Addr().String()})
+	require.NoError(t, sink.Send(testBuildAnalytics))
+
+	message := <-received
+	require.True(t, strings.HasPrefix(message, "<11>1 "), message)
+	require.True(t, strings.HasSuffix(message, "Build of workflow primary failed in 3s"), message)
+}
@@ -0,0 +1,201 @@
+package analytics
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	bitriseConfigs "github.com/bitrise-io/bitrise/configs"
+	"github.com/bitrise-io/bitrise/models"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// The test results deploy dir holds a directory per step, with the step's info
+// and a directory per test run containing the JUnit XML reports:
+//
+//	$BITRISE_TEST_DEPLOY_DIR/<step dir>/step-info.json
+//	$BITRISE_TEST_DEPLOY_DIR/<step dir>/<test run dir>/*.xml
+const testResultStepInfoFileName = "step-info.json"
+
+// TestResults are the totals of a step's test reports, no test names are collected.
+type TestResults struct {
+	Tests    int           `json:"tests"`
+	Failures int           `json:"failures"`
+	Errors   int           `json:"errors"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (r *TestResults) add(other TestResults) {
+	r.Tests += other.Tests
+	r.Failures += other.Failures
+	r.Errors += other.Errors
+	r.Skipped += other.Skipped
+	r.Duration += other.Duration
+}
+
+// junitSuite matches both the <testsuites> and the <testsuite> elements.
+type junitSuite struct {
+	Time   string       `xml:"time,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []struct {
+		Time     string     `xml:"time,attr"`
+		Failures []struct{} `xml:"failure"`
+		Errors   []struct{} `xml:"error"`
+		Skipped  []struct{} `xml:"skipped"`
+	} `xml:"testcase"`
+}
+
+func (s junitSuite) totals() TestResults {
+	var results TestResults
+	for _, suite := range s.Suites {
+		results.add(suite.totals())
+	}
+
+	var casesDuration time.Duration
+	for _, testCase := range s.Cases {
+		results.Tests++
+		switch {
+		case len(testCase.Failures) > 0:
+			results.Failures++
+		case len(testCase.Errors) > 0:
+			results.Errors++
+		case len(testCase.Skipped) > 0:
+			results.Skipped++
+		}
+		casesDuration += parseJUnitTime(testCase.Time)
+	}
+
+	// a leaf suite's time includes its setup and teardown,
+	// the nested suites' times are already counted
+	if suiteDuration := parseJUnitTime(s.Time); suiteDuration > 0 && len(s.Suites) == 0 {
+		results.Duration += suiteDuration
+	} else {
+		results.Duration += casesDuration
+	}
+	return results
+}
+
+func parseJUnitTime(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.Replace(value, ",", "", -1), 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ParseJUnitReport returns the totals of a JUnit XML report.
+func ParseJUnitReport(content []byte) (TestResults, error) {
+	var suite junitSuite
+	if err := xml.Unmarshal(content, &suite); err != nil {
+		return TestResults{}, err
+	}
+	return suite.totals(), nil
+}
+
+// CollectTestResults scans the test results deploy dir and returns the test result totals by step info.
+func CollectTestResults(testDeployDir string) (map[models.TestResultStepInfo]TestResults, error) {
+	stepDirs, err := ioutil.ReadDir(testDeployDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[models.TestResultStepInfo]TestResults{}
+	for _, stepDir := range stepDirs {
+		if !stepDir.IsDir() {
+			continue
+		}
+		stepDirPth := filepath.Join(testDeployDir, stepDir.Name())
+
+		content, err := ioutil.ReadFile(filepath.Join(stepDirPth, testResultStepInfoFileName))
+		if err != nil {
+			log.Debugf("Skipping test results without step info (%s): %s", stepDir.Name(), err)
+			continue
+		}
+		var stepInfo models.TestResultStepInfo
+		if err := json.Unmarshal(content, &stepInfo); err != nil {
+			log.Warnf("Skipping test results with invalid step info (%s): %s", stepDir.Name(), err)
+			continue
+		}
+
+		reports, err := filepath.Glob(filepath.Join(stepDirPth, "*", "*.xml"))
+		if err != nil {
+			return nil, err
+		}
+
+		stepResults := results[stepInfo]
+		for _, report := range reports {
+			content, err := ioutil.ReadFile(report)
+			if err != nil {
+				return nil, err
+			}
+			reportResults, err := ParseJUnitReport(content)
+			if err != nil {
+				log.Warnf("Skipping invalid JUnit report (%s): %s", filepath.Base(report), err)
+				continue
+			}
+			stepResults.add(reportResults)
+		}
+		results[stepInfo] = stepResults
+	}
+	return results, nil
+}
+
+// testResultsStep returns the step the test results belong to: the step of the step info's number,
+// which is the step's idx, if its id matches, the first step with the same id and version otherwise.
+func testResultsStep(stepInfo models.TestResultStepInfo, steps []StepAnalytics) *StepAnalytics {
+	if step := stepByIdx(steps, stepInfo.Number); step != nil && step.StepID == stepInfo.ID {
+		return step
+	}
+	for i := range steps {
+		if steps[i].StepID == stepInfo.ID && steps[i].StepVersion == stepInfo.Version && steps[i].TestResults == nil {
+			return &steps[i]
+		}
+	}
+	return nil
+}
+
+func enrichTestResults(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	testDeployDir := os.Getenv(bitriseConfigs.BitriseTestDeployDirEnvKey)
+	if testDeployDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(testDeployDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	results, err := CollectTestResults(testDeployDir)
+	if err != nil {
+		return err
+	}
+
+	stepInfos := make([]models.TestResultStepInfo, 0, len(results))
+	for stepInfo := range results {
+		stepInfos = append(stepInfos, stepInfo)
+	}
+	sort.Slice(stepInfos, func(i, j int) bool {
+		return stepInfos[i].Number < stepInfos[j].Number
+	})
+
+	for _, stepInfo := range stepInfos {
+		stepResults := results[stepInfo]
+		step := testResultsStep(stepInfo, buildAnalytics.StepAnalytics)
+		if step == nil {
+			log.Debugf("No step found for the test results of %s@%s (%d)", stepInfo.ID, stepInfo.Version, stepInfo.Number)
+			continue
+		}
+
+		if step.TestResults == nil {
+			step.TestResults = &TestResults{}
+		}
+		step.TestResults.add(stepResults)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	analyticsModels "github.com/bitrise-io/bitrise-step-analytics/models"
+	"github.com/bitrise-io/bitrise/models"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+const junitReport = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites time="12.5">
+	<testsuite name="LoginTests" time="10.25">
+		<testcase name="testLogin" time="4"/>
+		<testcase name="testLogout" time="5"><failure message="expected true"/></testcase>
+		<testcase name="testSignup" time="0"><skipped/></testcase>
+	</testsuite>
+	<testsuite name="CartTests">
+		<testcase name="testAdd" time="1.5"><error message="crashed"/></testcase>
+		<testcase name="testRemove" time="0.5"/>
+	</testsuite>
+</testsuites>`
+
+func TestParseJUnitReport(t *testing.T) {
+	results, err := ParseJUnitReport([]byte(junitReport))
+	require.NoError(t, err)
+	require.Equal(t, TestResults{Tests: 5, Failures: 1, Errors: 1, Skipped: 1, Duration: 12250 * time.Millisecond}, results)
+
+	results, err = ParseJUnitReport([]byte(`<testsuite time="1"><testcase/></testsuite>`))
+	require.NoError(t, err)
+	require.Equal(t, TestResults{Tests: 1, Duration: time.Second}, results)
+
+	_, err = ParseJUnitReport([]byte(`not xml`))
+	require.Error(t, err)
+}
+
+func TestEnrichTestResults(t *testing.T) {
+	testDeployDir, err := pathutil.NormalizedOSTempDirPath("test_results")
+	require.NoError(t, err)
+
+	writeFile := func(pth, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+		require.NoError(t, ioutil.WriteFile(pth, []byte(content), 0644))
+	}
+	writeFile(filepath.Join(testDeployDir, "step1", "step-info.json"), `{"id":"xcode-test","version":"2.4.0","title":"Xcode Test","number":1}`)
+	writeFile(filepath.Join(testDeployDir, "step1", "run1", "report.xml"), junitReport)
+	writeFile(filepath.Join(testDeployDir, "step1", "run2", "report.xml"), `<testsuite><testcase time="1"/></testsuite>`)
+	writeFile(filepath.Join(testDeployDir, "step1", "run2", "invalid.xml"), `<testsuite>`)
+	writeFile(filepath.Join(testDeployDir, "no-info", "run", "report.xml"), junitReport)
+
+	results, err := CollectTestResults(testDeployDir)
+	require.NoError(t, err)
+	require.Equal(t, map[models.TestResultStepInfo]TestResults{
+		{ID: "xcode-test", Version: "2.4.0", Title: "Xcode Test", Number: 1}: {Tests: 6, Failures: 1, Errors: 1, Skipped: 1, Duration: 13250 * time.Millisecond},
+	}, results)
+
+	require.NoError(t, os.Setenv("BITRISE_TEST_DEPLOY_DIR", testDeployDir))
+	defer func() {
+		require.NoError(t, os.Unsetenv("BITRISE_TEST_DEPLOY_DIR"))
+	}()
+
+	buildAnalytics := BuildAnalytics{StepAnalytics: []StepAnalytics{
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "script"}},
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test", StepVersion: "2.4.0"}},
+	}}
+	require.NoError(t, enrichTestResults(&buildAnalytics, configs.ConfigModel{}))
+	require.Nil(t, buildAnalytics.StepAnalytics[0].TestResults)
+	require.Equal(t, &TestResults{Tests: 6, Failures: 1, Errors: 1, Skipped: 1, Duration: 13250 * time.Millisecond}, buildAnalytics.StepAnalytics[1].TestResults)
+
+	// the test results are attached by the step's idx, not its position
+	buildAnalytics = BuildAnalytics{StepAnalytics: []StepAnalytics{
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test", StepVersion: "2.4.0"}, Idx: 3},
+		{StepAnalytics: analyticsModels.StepAnalytics{StepID: "xcode-test", StepVersion: "2.4.0"}, Idx: 1},
+	}}
+	require.NoError(t, enrichTestResults(&buildAnalytics, configs.ConfigModel{}))
+	require.Nil(t, buildAnalytics.StepAnalytics[0].TestResults)
+	require.Equal(t, 6, buildAnalytics.StepAnalytics[1].TestResults.Tests)
+}
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	bitriseConfigs "github.com/bitrise-io/bitrise/configs"
+)
+
+// TriggerContextVersion is the format version of the trigger context section,
+// bumped on incompatible changes.
+const TriggerContextVersion = 1
+
+// Trigger types
+const (
+	TriggerTypePush        = "push"
+	TriggerTypePullRequest = "pull_request"
+	TriggerTypeTag         = "tag"
+	TriggerTypeManual      = "manual"
+	TriggerTypeScheduled   = "scheduled"
+)
+
+const (
+	buildNumberEnvKey    = "BITRISE_BUILD_NUMBER"
+	branchEnvKey         = "BITRISE_GIT_BRANCH"
+	targetBranchEnvKey   = "BITRISEIO_GIT_BRANCH_DEST"
+	tagEnvKey            = "BITRISE_GIT_TAG"
+	commitEnvKey         = "BITRISE_GIT_COMMIT"
+	pullRequestEnvKey    = "BITRISE_PULL_REQUEST"
+	scheduledBuildEnvKey = "BITRISE_SCHEDULED_BUILD"
+	// branchHashKeyEnvKey is the secret key of the branch hashes, e.g. a secret env of the app.
+	branchHashKeyEnvKey = "BITRISE_ANALYTICS_BRANCH_HASH_KEY"
+)
+
+// TriggerContext describes what triggered the build.
+// Branch names are hashed with an HMAC keyed with a secret which is never sent, so they are comparable
+// between the builds sharing the key only. Without a key no branch hashes are collected.
+type TriggerContext struct {
+	Version          int    `json:"version"`
+	TriggerType      string `json:"trigger_type"`
+	IsPullRequest    bool   `json:"is_pull_request"`
+	BranchHash       string `json:"branch_hash,omitempty"`
+	TargetBranchHash string `json:"target_branch_hash,omitempty"`
+	BuildNumber      int    `json:"build_number,omitempty"`
+}
+
+// NewTriggerContext reads the trigger context from the envs exported by Bitrise.
+func NewTriggerContext(getenv func(string) string) TriggerContext {
+	isPullRequest := getenv(bitriseConfigs.PRModeEnvKey) == "true" ||
+		getenv(bitriseConfigs.PullRequestIDEnvKey) != "" ||
+		getenv(pullRequestEnvKey) != ""
+
+	var triggerType string
+	switch {
+	case getenv(tagEnvKey) != "":
+		triggerType = TriggerTypeTag
+	case isPullRequest:
+		triggerType = TriggerTypePullRequest
+	case getenv(scheduledBuildEnvKey) == "true":
+		triggerType = TriggerTypeScheduled
+	case getenv(commitEnvKey) != "":
+		triggerType = TriggerTypePush
+	default:
+		// builds started without a webhook have no commit hash
+		triggerType = TriggerTypeManual
+	}
+
+	triggerContext := TriggerContext{
+		Version:          TriggerContextVersion,
+		TriggerType:      triggerType,
+		IsPullRequest:    isPullRequest,
+		BranchHash:       hashBranch(getenv(branchHashKeyEnvKey), getenv(branchEnvKey)),
+		TargetBranchHash: hashBranch(getenv(branchHashKeyEnvKey), getenv(targetBranchEnvKey)),
+	}
+	if buildNumber, err := strconv.Atoi(getenv(buildNumberEnvKey)); err == nil {
+		triggerContext.BuildNumber = buildNumber
+	}
+	return triggerContext
+}
+
+// hashBranch returns the HMAC-SHA256 of the branch keyed with the key, it is empty without a key.
+func hashBranch(key, branch string) string {
+	if key == "" || branch == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(branch))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func enrichTriggerContext(buildAnalytics *BuildAnalytics, config configs.ConfigModel) error {
+	triggerContext := NewTriggerContext(os.Getenv)
+	buildAnalytics.TriggerContext = &triggerContext
+	return nil
+}
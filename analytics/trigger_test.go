@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTriggerContext(t *testing.T) {
+	tests := []struct {
+		name string
+		envs map[string]string
+		want TriggerContext
+	}{
+		{
+			name: "push",
+			envs: map[string]string{"BITRISE_GIT_BRANCH": "main", "BITRISE_GIT_COMMIT": "abc123", "BITRISE_BUILD_NUMBER": "42", "BITRISE_ANALYTICS_BRANCH_HASH_KEY": "secret"},
+			want: TriggerContext{Version: 1, TriggerType: "push", BranchHash: hashBranch("secret", "main"), BuildNumber: 42},
+		},
+		{
+			name: "pull request",
+			envs: map[string]string{"BITRISE_GIT_BRANCH": "feature", "BITRISEIO_GIT_BRANCH_DEST": "main", "PR": "true", "BITRISE_GIT_COMMIT": "abc123", "BITRISE_ANALYTICS_BRANCH_HASH_KEY": "secret"},
+			want: TriggerContext{Version: 1, TriggerType: "pull_request", IsPullRequest: true, BranchHash: hashBranch("secret", "feature"), TargetBranchHash: hashBranch("secret", "main")},
+		},
+		{
+			name: "tag",
+			envs: map[string]string{"BITRISE_GIT_TAG": "1.0.0", "BITRISE_GIT_COMMIT": "abc123"},
+			want: TriggerContext{Version: 1, TriggerType: "tag"},
+		},
+		{
+			name: "scheduled",
+			envs: map[string]string{"BITRISE_SCHEDULED_BUILD": "true", "BITRISE_GIT_BRANCH": "main", "BITRISE_ANALYTICS_BRANCH_HASH_KEY": "secret"},
+			want: TriggerContext{Version: 1, TriggerType: "scheduled", BranchHash: hashBranch("secret", "main")},
+		},
+		{
+			name: "manual without branch hash key",
+			envs: map[string]string{"BITRISE_GIT_BRANCH": "main", "BITRISE_BUILD_NUMBER": "not a number"},
+			want: TriggerContext{Version: 1, TriggerType: "manual"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewTriggerContext(func(key string) string { return tt.envs[key] })
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	require.NotEqual(t, hashBranch("secret", "main"), hashBranch("other-secret", "main"))
+	require.Len(t, hashBranch("secret", "main"), 64)
+	require.Empty(t, hashBranch("", "main"))
+}
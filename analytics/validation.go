@@ -0,0 +1,276 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bitrise-io/bitrise/models"
+)
+
+// Severity tells how much a payload problem affects the build analytics.
+type Severity string
+
+// Severities
+const (
+	// SeverityWarning: the problem's field is missing or unreliable.
+	SeverityWarning Severity = "warning"
+	// SeverityError: the problem makes the build analytics wrong.
+	SeverityError Severity = "error"
+)
+
+// Step lists of the build run results
+const (
+	successStepsField         = "success_steps"
+	failedStepsField          = "failed_steps"
+	failedSkippableStepsField = "failed_skippable_steps"
+	skippedStepsField         = "skipped_steps"
+)
+
+// Problem is a semantic problem of a payload, which is valid JSON.
+type Problem struct {
+	Severity Severity `json:"severity"`
+	// Field is the path of the problem's field, like failed_steps[0].run_time.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Fixable tells whether FixPayload fixes the problem.
+	Fixable bool `json:"fixable"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Field, p.Message)
+}
+
+// HasErrors tells whether any of the problems is an error.
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationPolicy decides what happens to the payloads with problems.
+type ValidationPolicy string
+
+// ValidationPolicies
+const (
+	// ValidationPolicySend sends the payloads as-is, the problems are only logged.
+	ValidationPolicySend ValidationPolicy = "send"
+	// ValidationPolicyFix fixes the fixable problems, and sends the payloads.
+	ValidationPolicyFix ValidationPolicy = "fix"
+	// ValidationPolicyDrop does not send the payloads with errors.
+	ValidationPolicyDrop ValidationPolicy = "drop"
+)
+
+// ParseValidationPolicy parses the configured policy, send if it is not set.
+func ParseValidationPolicy(policy string) (ValidationPolicy, error) {
+	switch ValidationPolicy(policy) {
+	case "":
+		return ValidationPolicySend, nil
+	case ValidationPolicySend, ValidationPolicyFix, ValidationPolicyDrop:
+		return ValidationPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown validation policy: %s (options: send, fix, drop)", policy)
+}
+
+// ApplyValidationPolicy validates the build run results and applies the policy on them,
+// it returns the problems found, and false if the build run results must not be sent.
+func ApplyValidationPolicy(policy ValidationPolicy, buildRunResults *BuildRunResults) ([]Problem, bool) {
+	problems := ValidatePayload(buildRunResults.BuildRunResultsModel)
+	switch policy {
+	case ValidationPolicyFix:
+		fixed, indexes := fixPayload(buildRunResults.BuildRunResultsModel)
+		buildRunResults.StepDetails = rekeyStepDetails(*buildRunResults, indexes)
+		buildRunResults.stepDetailsAt = nil
+		buildRunResults.BuildRunResultsModel = fixed
+	case ValidationPolicyDrop:
+		return problems, !HasErrors(problems)
+	}
+	return problems, true
+}
+
+// stepList is one of the step lists of the build run results.
+type stepList struct {
+	field string
+	steps *[]models.StepRunResultsModel
+}
+
+func stepLists(buildRunResults *models.BuildRunResultsModel) []stepList {
+	return []stepList{
+		{successStepsField, &buildRunResults.SuccessSteps},
+		{failedStepsField, &buildRunResults.FailedSteps},
+		{failedSkippableStepsField, &buildRunResults.FailedSkippableSteps},
+		{skippedStepsField, &buildRunResults.SkippedSteps},
+	}
+}
+
+// stepListOfStatus returns the step list the Bitrise CLI puts the steps of the status code in,
+// it is empty for unknown codes.
+func stepListOfStatus(code int) string {
+	switch code {
+	case models.StepRunStatusCodeSuccess:
+		return successStepsField
+	case models.StepRunStatusCodeFailedSkippable:
+		return failedSkippableStepsField
+	case models.StepRunStatusCodeSkipped, models.StepRunStatusCodeSkippedWithRunIf:
+		return skippedStepsField
+	}
+	if isFailedStepStatus(stepStatus(code)) {
+		return failedStepsField
+	}
+	return ""
+}
+
+// ValidatePayload returns the semantic problems of the build run results.
+func ValidatePayload(buildRunResults models.BuildRunResultsModel) []Problem {
+	var problems []Problem
+	add := func(severity Severity, field string, fixable bool, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Severity: severity,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+			Fixable:  fixable,
+		})
+	}
+
+	var (
+		indexes           = map[int]string{}
+		earliestStepStart time.Time
+	)
+	for _, list := range stepLists(&buildRunResults) {
+		for i, step := range *list.steps {
+			field := fmt.Sprintf("%s[%d]", list.field, i)
+
+			if step.StepInfo.ID == "" {
+				add(SeverityWarning, field+".step_info.id", false, "missing step id")
+			}
+
+			if expected := stepListOfStatus(step.Status); expected == "" {
+				add(SeverityWarning, field+".status", false, "unknown status code (%d)", step.Status)
+			} else if expected != list.field {
+				add(SeverityError, field+".status", true, "status code (%d) of a step in %s, expected in %s", step.Status, list.field, expected)
+			}
+
+			if step.Idx < 0 {
+				add(SeverityError, field+".idx", true, "negative idx (%d)", step.Idx)
+			} else if other, ok := indexes[step.Idx]; ok {
+				add(SeverityError, field+".idx", true, "duplicated idx (%d), also used by %s", step.Idx, other)
+			} else {
+				indexes[step.Idx] = field
+			}
+
+			if step.RunTime < 0 {
+				add(SeverityError, field+".run_time", true, "negative run time (%s)", step.RunTime)
+			}
+
+			if step.StartTime.IsZero() {
+				add(SeverityWarning, field+".start_time", false, "missing start time")
+			} else {
+				if earliestStepStart.IsZero() || step.StartTime.Before(earliestStepStart) {
+					earliestStepStart = step.StartTime
+				}
+				if !buildRunResults.StartTime.IsZero() && step.StartTime.Before(buildRunResults.StartTime) {
+					add(SeverityWarning, field+".start_time", false, "start time (%s) before the build's start time", step.StartTime.Format(time.RFC3339))
+				}
+			}
+		}
+	}
+
+	if buildRunResults.StartTime.IsZero() {
+		add(SeverityWarning, "start_time", !earliestStepStart.IsZero(), "missing start time")
+	}
+
+	return problems
+}
+
+// FixPayload returns the build run results with the fixable problems fixed:
+// the steps are moved to the list of their status code, negative run times are set to 0,
+// negative and duplicated indexes get unused indexes after the last step's,
+// and the missing build start time is set to the earliest step start time.
+func FixPayload(buildRunResults models.BuildRunResultsModel) models.BuildRunResultsModel {
+	fixed, _ := fixPayload(buildRunResults)
+	return fixed
+}
+
+// fixPayload fixes the build run results and returns the fixed idx of the steps by their original position.
+func fixPayload(buildRunResults models.BuildRunResultsModel) (models.BuildRunResultsModel, map[stepPosition]int) {
+	fixed := buildRunResults
+	for _, list := range stepLists(&fixed) {
+		*list.steps = nil
+	}
+	lists := map[string]*[]models.StepRunResultsModel{}
+	for _, list := range stepLists(&fixed) {
+		lists[list.field] = list.steps
+	}
+
+	maxIdx := -1
+	for _, list := range stepLists(&buildRunResults) {
+		for _, step := range *list.steps {
+			if step.Idx > maxIdx {
+				maxIdx = step.Idx
+			}
+		}
+	}
+
+	used := map[int]bool{}
+	indexes := map[stepPosition]int{}
+	for _, list := range stepLists(&buildRunResults) {
+		for i, step := range *list.steps {
+			if step.Idx < 0 || used[step.Idx] {
+				maxIdx++
+				step.Idx = maxIdx
+			}
+			used[step.Idx] = true
+			indexes[stepPosition{field: list.field, index: i}] = step.Idx
+
+			if step.RunTime < 0 {
+				step.RunTime = 0
+			}
+
+			field := stepListOfStatus(step.Status)
+			if field == "" {
+				field = list.field
+			}
+			*lists[field] = append(*lists[field], step)
+		}
+	}
+
+	if fixed.StartTime.IsZero() {
+		for _, list := range stepLists(&fixed) {
+			for _, step := range *list.steps {
+				if !step.StartTime.IsZero() && (fixed.StartTime.IsZero() || step.StartTime.Before(fixed.StartTime)) {
+					fixed.StartTime = step.StartTime
+				}
+			}
+		}
+	}
+
+	return fixed, indexes
+}
+
+// rekeyStepDetails returns the step details keyed by the fixed idx of the steps.
+// The details are looked up by the steps' position if the payload was decoded,
+// as the details of steps with duplicated idx are only told apart by it.
+func rekeyStepDetails(buildRunResults BuildRunResults, indexes map[stepPosition]int) map[int]StepRunDetails {
+	var details map[int]StepRunDetails
+	for _, list := range stepLists(&buildRunResults.BuildRunResultsModel) {
+		for i, step := range *list.steps {
+			position := stepPosition{field: list.field, index: i}
+
+			stepDetails, ok := buildRunResults.StepDetails[step.Idx]
+			if buildRunResults.stepDetailsAt != nil {
+				stepDetails, ok = buildRunResults.stepDetailsAt[position]
+			}
+			if !ok {
+				continue
+			}
+
+			if details == nil {
+				details = map[int]StepRunDetails{}
+			}
+			details[indexes[position]] = stepDetails
+		}
+	}
+	return details
+}
@@ -0,0 +1,164 @@
+package analytics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/bitrise/models"
+	stepmanModels "github.com/bitrise-io/stepman/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePayload(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	step := func(idx, status int, runTime time.Duration) models.StepRunResultsModel {
+		return models.StepRunResultsModel{
+			StepInfo:  stepmanModels.StepInfoModel{ID: "script"},
+			Idx:       idx,
+			Status:    status,
+			RunTime:   runTime,
+			StartTime: start.Add(time.Duration(idx) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name            string
+		buildRunResults models.BuildRunResultsModel
+		want            []Problem
+	}{
+		{
+			name: "valid payload",
+			buildRunResults: models.BuildRunResultsModel{
+				StartTime:    start,
+				SuccessSteps: []models.StepRunResultsModel{step(0, 0, time.Second)},
+				FailedSteps:  []models.StepRunResultsModel{step(1, 7, time.Second)},
+			},
+		},
+		{
+			name: "negative run time",
+			buildRunResults: models.BuildRunResultsModel{
+				StartTime:    start,
+				SuccessSteps: []models.StepRunResultsModel{step(0, 0, -time.Second)},
+			},
+			want: []Problem{
+				{Severity: SeverityError, Field: "success_steps[0].run_time", Message: "negative run time (-1s)", Fixable: true},
+			},
+		},
+		{
+			name: "duplicated idx",
+			buildRunResults: models.BuildRunResultsModel{
+				StartTime:    start,
+				SuccessSteps: []models.StepRunResultsModel{step(0, 0, time.Second)},
+				SkippedSteps: []models.StepRunResultsModel{step(0, 3, 0)},
+			},
+			want: []Problem{
+				{Severity: SeverityError, Field: "skipped_steps[0].idx", Message: "duplicated idx (0), also used by success_steps[0]", Fixable: true},
+			},
+		},
+		{
+			name: "status code in the wrong list",
+			buildRunResults: models.BuildRunResultsModel{
+				StartTime:    start,
+				SuccessSteps: []models.StepRunResultsModel{step(0, 1, time.Second)},
+			},
+			want: []Problem{
+				{Severity: SeverityError, Field: "success_steps[0].status", Message: "status code (1) of a step in success_steps, expected in failed_steps", Fixable: true},
+			},
+		},
+		{
+			name: "missing start times",
+			buildRunResults: models.BuildRunResultsModel{
+				SuccessSteps: []models.StepRunResultsModel{{StepInfo: stepmanModels.StepInfoModel{ID: "script"}, Status: 42}},
+			},
+			want: []Problem{
+				{Severity: SeverityWarning, Field: "success_steps[0].status", Message: "unknown status code (42)"},
+				{Severity: SeverityWarning, Field: "success_steps[0].start_time", Message: "missing start time"},
+				{Severity: SeverityWarning, Field: "start_time", Message: "missing start time"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := ValidatePayload(tt.buildRunResults)
+			require.Equal(t, tt.want, problems)
+
+			// the fixable problems are fixed
+			for _, problem := range ValidatePayload(FixPayload(tt.buildRunResults)) {
+				require.False(t, problem.Fixable, "not fixed: %s", problem)
+			}
+		})
+	}
+}
+
+func TestFixPayload(t *testing.T) {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	buildRunResults := models.BuildRunResultsModel{
+		SuccessSteps: []models.StepRunResultsModel{
+			{Idx: 0, Status: 0, RunTime: -time.Second, StartTime: start.Add(time.Minute)},
+			{Idx: 1, Status: 1, StartTime: start},
+		},
+		SkippedSteps: []models.StepRunResultsModel{{Idx: 1, Status: 3}},
+	}
+
+	fixed := FixPayload(buildRunResults)
+	require.Equal(t, start, fixed.StartTime)
+	require.Equal(t, []models.StepRunResultsModel{{Idx: 0, Status: 0, StartTime: start.Add(time.Minute)}}, fixed.SuccessSteps)
+	require.Equal(t, []models.StepRunResultsModel{{Idx: 1, Status: 1, StartTime: start}}, fixed.FailedSteps)
+	require.Equal(t, []models.StepRunResultsModel{{Idx: 2, Status: 3}}, fixed.SkippedSteps)
+
+	// the original build run results are not modified
+	require.Equal(t, -time.Second, buildRunResults.SuccessSteps[0].RunTime)
+	require.Equal(t, 2, len(buildRunResults.SuccessSteps))
+}
+
+func TestFixPayloadStepDetails(t *testing.T) {
+	buildRunResults, err := DecodePayload([]byte(`{
+	"success_steps": [
+		{"step_info": {"id": "script"}, "status": 0, "idx": 0, "step_bundle": "setup"},
+		{"step_info": {"id": "deploy"}, "status": 0, "idx": 0, "step_bundle": "deploy"},
+		{"step_info": {"id": "cache"}, "status": 0, "idx": -1}
+	],
+	"skipped_steps": [
+		{"step_info": {"id": "test"}, "status": 3, "idx": 1, "container": "ruby:3.0"}
+	]
+}`))
+	require.NoError(t, err)
+
+	_, send := ApplyValidationPolicy(ValidationPolicyFix, &buildRunResults)
+	require.True(t, send)
+	require.Equal(t, map[int]StepRunDetails{
+		0: {Extras: map[string]json.RawMessage{"step_bundle": json.RawMessage(`"setup"`)}},
+		2: {Extras: map[string]json.RawMessage{"step_bundle": json.RawMessage(`"deploy"`)}},
+		1: {Extras: map[string]json.RawMessage{"container": json.RawMessage(`"ruby:3.0"`)}},
+	}, buildRunResults.StepDetails)
+}
+
+func TestApplyValidationPolicy(t *testing.T) {
+	invalid := BuildRunResults{BuildRunResultsModel: models.BuildRunResultsModel{
+		SuccessSteps: []models.StepRunResultsModel{{Status: 0, RunTime: -time.Second}},
+	}}
+
+	for _, tt := range []struct {
+		policy      string
+		wantSend    bool
+		wantRunTime time.Duration
+	}{
+		{"", true, -time.Second},
+		{"send", true, -time.Second},
+		{"fix", true, 0},
+		{"drop", false, -time.Second},
+	} {
+		policy, err := ParseValidationPolicy(tt.policy)
+		require.NoError(t, err)
+
+		buildRunResults := invalid
+		problems, send := ApplyValidationPolicy(policy, &buildRunResults)
+		require.True(t, HasErrors(problems))
+		require.Equal(t, tt.wantSend, send, "policy: %s", tt.policy)
+		require.Equal(t, tt.wantRunTime, buildRunResults.SuccessSteps[0].RunTime, "policy: %s", tt.policy)
+	}
+
+	_, err := ParseValidationPolicy("ignore")
+	require.Error(t, err)
+}
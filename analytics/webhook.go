@@ -0,0 +1,268 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const webhookStatusFileName = "webhook_status.json"
+
+// WebhookSink sends the build analytics in a request rendered from the webhook's templates.
+type WebhookSink struct {
+	config configs.WebhookConfigModel
+}
+
+// NewWebhookSink ...
+func NewWebhookSink(config configs.WebhookConfigModel) WebhookSink {
+	return WebhookSink{config: config}
+}
+
+// Name ...
+func (s WebhookSink) Name() string {
+	return fmt.Sprintf("webhook (%s)", s.config.Name)
+}
+
+// WebhookRequest is a webhook request rendered with the build analytics.
+type WebhookRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+}
+
+// Send ...
+// The build status of a webhook triggered on status change is recorded once the request succeeded,
+// so a failed request is sent again with the next try.
+func (s WebhookSink) Send(buildAnalytics BuildAnalytics) error {
+	if triggered, err := s.triggered(buildAnalytics); err != nil {
+		return err
+	} else if !triggered {
+		log.Debugf("Webhook %s not triggered (trigger: %s)", s.config.Name, s.config.Trigger)
+		return s.recordStatus(buildAnalytics)
+	}
+
+	webhookReq, err := s.Render(buildAnalytics)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(webhookReq.Method, webhookReq.URL, strings.NewReader(webhookReq.Body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range webhookReq.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := http.Client{
+		Timeout: time.Duration(10 * time.Second),
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform webhook request: %s", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Errorf("failed to close response body, error: %#v", err)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook request failed with status code: %d (%s)", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return s.recordStatus(buildAnalytics)
+}
+
+// recordStatus records the build status of the workflow for the webhooks triggered on status change.
+func (s WebhookSink) recordStatus(buildAnalytics BuildAnalytics) error {
+	if s.config.Trigger != configs.WebhookTriggerOnStatusChange {
+		return nil
+	}
+	if err := writeWebhookStatus(s.config.Name, buildAnalytics.WorkflowName, buildAnalytics.Status); err != nil {
+		return fmt.Errorf("failed to record build status: %s", err)
+	}
+	return nil
+}
+
+// Render renders the webhook's URL, headers and body templates.
+func (s WebhookSink) Render(buildAnalytics BuildAnalytics) (WebhookRequest, error) {
+	webhookReq := WebhookRequest{
+		Method:  s.config.Method,
+		Headers: map[string]string{},
+	}
+	if webhookReq.Method == "" {
+		webhookReq.Method = http.MethodPost
+	}
+
+	var err error
+	if webhookReq.URL, err = renderWebhookTemplate("url", s.config.URL, buildAnalytics); err != nil {
+		return WebhookRequest{}, err
+	}
+	if webhookReq.URL == "" {
+		return WebhookRequest{}, errors.New("url is not configured")
+	}
+
+	for key, value := range s.config.Headers {
+		if webhookReq.Headers[key], err = renderWebhookTemplate("header "+key, value, buildAnalytics); err != nil {
+			return WebhookRequest{}, err
+		}
+	}
+
+	if s.config.BodyTemplate != "" {
+		pth := s.config.BodyTemplate
+		if !filepath.IsAbs(pth) {
+			pth = filepath.Join(configs.DataDir, pth)
+		}
+
+		content, err := ioutil.ReadFile(pth)
+		if err != nil {
+			return WebhookRequest{}, fmt.Errorf("failed to read body template: %s", err)
+		}
+		if webhookReq.Body, err = renderWebhookTemplate(filepath.Base(pth), string(content), buildAnalytics); err != nil {
+			return WebhookRequest{}, err
+		}
+	}
+
+	return webhookReq, nil
+}
+
+func (s WebhookSink) triggered(buildAnalytics BuildAnalytics) (bool, error) {
+	switch s.config.Trigger {
+	case "", configs.WebhookTriggerAlways:
+		return true, nil
+	case configs.WebhookTriggerOnFailure:
+		return isFailedBuildStatus(buildAnalytics.Status), nil
+	case configs.WebhookTriggerOnStatusChange:
+		previous, err := readWebhookStatus(s.config.Name, buildAnalytics.WorkflowName)
+		if err != nil {
+			return false, fmt.Errorf("failed to check previous build status: %s", err)
+		}
+		return previous != "" && previous != buildAnalytics.Status, nil
+	default:
+		return false, fmt.Errorf("unknown trigger: %s (options: %s, %s, %s)", s.config.Trigger,
+			configs.WebhookTriggerAlways, configs.WebhookTriggerOnFailure, configs.WebhookTriggerOnStatusChange)
+	}
+}
+
+func webhookStatusFilePath() (string, error) {
+	if configs.DataDir == "" {
+		return "", errors.New("plugin data dir is not set")
+	}
+	return filepath.Join(configs.DataDir, webhookStatusFileName), nil
+}
+
+// readWebhookStatuses returns the recorded build statuses by webhook and workflow.
+func readWebhookStatuses(pth string) (map[string]map[string]string, error) {
+	statuses := map[string]map[string]string{}
+	if exist, err := pathutil.IsPathExists(pth); err != nil {
+		return nil, err
+	} else if !exist {
+		return statuses, nil
+	}
+
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// readWebhookStatus returns the build status of the workflow recorded for the webhook.
+func readWebhookStatus(webhook, workflow string) (string, error) {
+	pth, err := webhookStatusFilePath()
+	if err != nil {
+		return "", err
+	}
+	statuses, err := readWebhookStatuses(pth)
+	if err != nil {
+		return "", err
+	}
+	return statuses[webhook][workflow], nil
+}
+
+// writeWebhookStatus records the build status of the workflow for the webhook.
+func writeWebhookStatus(webhook, workflow, status string) error {
+	pth, err := webhookStatusFilePath()
+	if err != nil {
+		return err
+	}
+	statuses, err := readWebhookStatuses(pth)
+	if err != nil {
+		return err
+	}
+
+	if statuses[webhook] == nil {
+		statuses[webhook] = map[string]string{}
+	}
+	statuses[webhook][workflow] = status
+
+	content, err := json.Marshal(statuses)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pth, content, 0600)
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+	"failedSteps": func(buildAnalytics BuildAnalytics) []StepAnalytics {
+		var failed []StepAnalytics
+		for _, step := range buildAnalytics.StepAnalytics {
+			if isFailedStepStatus(step.Status) {
+				failed = append(failed, step)
+			}
+		}
+		return failed
+	},
+	"statusEmoji": func(status string) string {
+		switch status {
+		case "successful", "success":
+			return "✅"
+		case "failed", "preparation_failed":
+			return "❌"
+		case "aborted", "aborted_with_timeout", "aborted_with_no_output":
+			return "⏱️"
+		case "failed_skippable", "failed_skippable_only":
+			return "⚠️"
+		case "skipped", "skipped_with_runif":
+			return "⏭️"
+		}
+		return "❔"
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func renderWebhookTemplate(name, text string, buildAnalytics BuildAnalytics) (string, error) {
+	tmpl, err := template.New(name).Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %s", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, buildAnalytics); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %s", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,119 @@
+package analytics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSinkRender(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("webhook")
+	require.NoError(t, err)
+
+	bodyTemplate := `{"text": {{ json (printf "%s %s finished in %s" (statusEmoji .Status) .WorkflowName (duration .Runtime)) }}, "failed": [{{ range $i, $step := failedSteps . }}{{ if $i }},{{ end }}{{ json $step.StepID }}{{ end }}]}`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "chat.json.tmpl"), []byte(bodyTemplate), 0600))
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	sink := NewWebhookSink(configs.WebhookConfigModel{
+		Name:         "chat",
+		URL:          "https://chat.example.com/hooks/{{ .StackID }}",
+		Headers:      map[string]string{"X-Workflow": "{{ .WorkflowName }}"},
+		BodyTemplate: "chat.json.tmpl",
+	})
+
+	req, err := sink.Render(testBuildAnalytics)
+	require.NoError(t, err)
+	require.Equal(t, WebhookRequest{
+		Method:  "POST",
+		URL:     "https://chat.example.com/hooks/osx-xcode-12.0.x",
+		Headers: map[string]string{"X-Workflow": "primary"},
+		Body:    `{"text": "❌ primary finished in 3s", "failed": ["xcode-test"]}`,
+	}, req)
+
+	_, err = NewWebhookSink(configs.WebhookConfigModel{Name: "invalid", URL: "{{ .Unknown }}"}).Render(testBuildAnalytics)
+	require.Error(t, err)
+}
+
+func TestWebhookSinkTriggered(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("webhook")
+	require.NoError(t, err)
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	failed := testBuildAnalytics
+	successful := testBuildAnalytics
+	successful.Status = "successful"
+
+	onFailure := NewWebhookSink(configs.WebhookConfigModel{Name: "on-failure", Trigger: configs.WebhookTriggerOnFailure})
+	triggered, err := onFailure.triggered(failed)
+	require.NoError(t, err)
+	require.True(t, triggered)
+	triggered, err = onFailure.triggered(successful)
+	require.NoError(t, err)
+	require.False(t, triggered)
+
+	_, err = NewWebhookSink(configs.WebhookConfigModel{Trigger: "sometimes"}).triggered(failed)
+	require.Error(t, err)
+}
+
+func TestWebhookSinkOnStatusChange(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("webhook")
+	require.NoError(t, err)
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	var requests int
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	failed := testBuildAnalytics
+	successful := testBuildAnalytics
+	successful.Status = "successful"
+
+	onStatusChange := NewWebhookSink(configs.WebhookConfigModel{Name: "on-change", URL: server.URL, Trigger: configs.WebhookTriggerOnStatusChange})
+	for _, step := range []struct {
+		build        BuildAnalytics
+		fail         bool
+		wantRequests int
+	}{
+		{build: successful, wantRequests: 0},
+		{build: successful, wantRequests: 0},
+		{build: failed, wantRequests: 1},
+		{build: failed, wantRequests: 1},
+		// the status is not recorded if the request fails, the retry sends it
+		{build: successful, fail: true, wantRequests: 2},
+		{build: successful, wantRequests: 3},
+		{build: successful, wantRequests: 3},
+	} {
+		fail = step.fail
+		err := onStatusChange.Send(step.build)
+		if step.fail {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, step.wantRequests, requests)
+	}
+}
@@ -1,18 +1,19 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
 	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
-	"github.com/bitrise-io/bitrise/models"
 	log "github.com/bitrise-io/go-utils/log"
 )
 
 // PayloadSource ...
 type PayloadSource interface {
-	Payload() (models.BuildRunResultsModel, error)
+	Payload() (analytics.BuildRunResults, error)
 }
 
 // SourceType ...
@@ -22,17 +23,57 @@ type SourceType int
 const (
 	StdinSource SourceType = iota
 	EnvSource
+	FileSource
 )
 
-// PayloadSourceFactory ....
-func PayloadSourceFactory(t SourceType) PayloadSource {
-	if t == StdinSource {
-		return StdinPayloadSource{os.Stdin}
+var sourceTypeNames = map[SourceType]string{
+	StdinSource: "stdin",
+	EnvSource:   "env",
+	FileSource:  "file",
+}
+
+func (t SourceType) String() string {
+	return sourceTypeNames[t]
+}
+
+// ParseSourceType ...
+func ParseSourceType(name string) (SourceType, error) {
+	for t, n := range sourceTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown payload source: %s (options: stdin, env, file)", name)
+}
+
+// PayloadSourceOptions configures the payload sources.
+type PayloadSourceOptions struct {
+	// PayloadFile is the file read by the file source.
+	PayloadFile string
+	// MaxSize is the maximum size of the stdin payload in bytes, the default maximum if not set.
+	MaxSize int64
+	Decoder analytics.PayloadDecoder
+}
+
+// PayloadSourceFactory returns the payload source of the type.
+func PayloadSourceFactory(t SourceType, opts PayloadSourceOptions) (PayloadSource, error) {
+	switch t {
+	case StdinSource:
+		return StdinPayloadSource{reader: os.Stdin, decoder: opts.Decoder, maxSize: opts.MaxSize}, nil
+	case EnvSource:
+		return EnvPayloadSource{envValue: os.Getenv(configs.PluginConfigPayloadKey), decoder: opts.Decoder}, nil
+	case FileSource:
+		if opts.PayloadFile == "" {
+			return nil, errors.New("payload file not provided")
+		}
+		return FilePayloadSource{pth: opts.PayloadFile, decoder: opts.Decoder}, nil
+	default:
+		return nil, fmt.Errorf("unknown payload source type: %d", t)
 	}
-	return EnvPayloadSource{os.Getenv(configs.PluginConfigPayloadKey)}
 }
 
-func sendAnalytics(source PayloadSource) error {
+// sendAnalytics sends the build run results of the source, force sends the already delivered builds too.
+func sendAnalytics(source PayloadSource, force bool) error {
 	payload, err := source.Payload()
 	if err != nil {
 		return fmt.Errorf("failed to read payload: %s", err)
@@ -43,5 +84,196 @@ func sendAnalytics(source PayloadSource) error {
 	log.Infof("For more information visit:")
 	log.Infof("https://github.com/bitrise-io/bitrise-plugins-analytics/blob/master/README.md")
 
-	return analytics.SendAnonymizedAnalytics(payload)
+	config, err := configs.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read analytics configuration: %s", err)
+	}
+
+	buildAnalytics, send, err := newBuildAnalytics(config, payload)
+	if err != nil {
+		return err
+	}
+
+	// the run finished even if its payload is dropped, its marker must not be reported as aborted
+	finishRun(config, &buildAnalytics)
+	if !send {
+		return nil
+	}
+
+	analytics.Enrich(&buildAnalytics, config)
+
+	if err := deliverAnalytics(config, buildAnalytics, force); err == errAlreadyDelivered {
+		log.Warnf("Build (%s) already delivered, skipping, use --force to send it again", analytics.NewSubmissionID(buildAnalytics))
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// newBuildAnalytics applies the configured validation policy on the payload and creates its build analytics,
+// it returns false if the payload must not be sent.
+func newBuildAnalytics(config configs.ConfigModel, payload analytics.BuildRunResults) (analytics.BuildAnalytics, bool, error) {
+	for key := range payload.Extras {
+		log.Debugf("Payload field unknown to the plugin: %s", key)
+	}
+
+	policy, err := analytics.ParseValidationPolicy(config.ValidationPolicy)
+	if err != nil {
+		return analytics.BuildAnalytics{}, false, err
+	}
+	problems, send := analytics.ApplyValidationPolicy(policy, &payload)
+	for _, problem := range problems {
+		// warnings are expected from older Bitrise CLIs, they are not worth the build log
+		if problem.Severity == analytics.SeverityError {
+			log.Warnf("Payload problem, %s", problem)
+		} else {
+			log.Debugf("Payload problem, %s", problem)
+		}
+	}
+	if !send {
+		log.Warnf("Payload with errors dropped, as configured by the validation policy")
+		return analytics.BuildAnalytics{}, false, nil
+	}
+
+	return analytics.NewBuildAnalytics(payload), true, nil
+}
+
+var errAlreadyDelivered = errors.New("build already delivered")
+
+// deliverAnalytics runs the processors on the build analytics, records it in the local history
+// and sends it to the hooks, the sinks and the analytics collector.
+// Each destination gets the build once: the builds already in the local history are not recorded again,
+// and the hooks and the sinks recorded in the ledger as delivered are skipped. Builds delivered
+// to the collector are skipped with errAlreadyDelivered, unless force is set, which sends them
+// to the collector again, without re-running the hooks and the sinks.
+func deliverAnalytics(config configs.ConfigModel, buildAnalytics analytics.BuildAnalytics, force bool) error {
+	buildAnalytics.SubmissionID = analytics.NewSubmissionID(buildAnalytics)
+	delivered := map[string]bool{}
+	if buildAnalytics.SubmissionID != "" {
+		var err error
+		if delivered, err = analytics.DeliveredDestinations(buildAnalytics.SubmissionID); err != nil {
+			log.Warnf("Failed to check the ledger of delivered builds: %s", err)
+			delivered = map[string]bool{}
+		}
+	}
+	if delivered[analytics.DestinationCollector] && !force {
+		return errAlreadyDelivered
+	}
+
+	buildAnalytics = analytics.RunProcessors(config.Processors, buildAnalytics)
+
+	if history, err := analytics.ReadHistory(); err != nil {
+		log.Warnf("Failed to read the local history: %s", err)
+	} else if !analytics.IsRecorded(history, buildAnalytics) {
+		if err := analytics.AppendHistory(buildAnalytics); err != nil {
+			log.Warnf("Failed to record build in the local history: %s", err)
+		}
+	}
+
+	var hooks []configs.HookConfigModel
+	for _, hook := range config.Hooks {
+		if !delivered[analytics.HookDestination(hook.Name)] {
+			hooks = append(hooks, hook)
+		}
+	}
+	for _, result := range analytics.RunHooks(hooks, config.HooksConcurrency, buildAnalytics) {
+		if result.Err == nil {
+			recordDelivery(buildAnalytics, analytics.HookDestination(result.Name))
+		}
+	}
+
+	for _, sink := range analytics.SinksFromConfig(config) {
+		if delivered[analytics.SinkDestination(sink.Name())] {
+			continue
+		}
+		if err := sink.Send(buildAnalytics); err != nil {
+			log.Warnf("Failed to send analytics to %s: %s", sink.Name(), err)
+		} else {
+			recordDelivery(buildAnalytics, analytics.SinkDestination(sink.Name()))
+		}
+	}
+
+	if err := analytics.SendAnonymizedAnalytics(buildAnalytics, config); err != nil {
+		return err
+	}
+	recordDelivery(buildAnalytics, analytics.DestinationCollector)
+	return nil
+}
+
+// recordDelivery records the delivery of the build to the destination in the ledger, if the build has a submission ID.
+func recordDelivery(buildAnalytics analytics.BuildAnalytics, destination string) {
+	if buildAnalytics.SubmissionID == "" {
+		return
+	}
+	if err := analytics.RecordDelivery(buildAnalytics.SubmissionID, destination, time.Now()); err != nil {
+		log.Warnf("Failed to record the delivery in the ledger: %s", err)
+	}
+}
+
+// startRun reports the builds that never finished and writes the starting build's run marker.
+func startRun() error {
+	config, err := configs.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read analytics configuration: %s", err)
+	}
+
+	pid, err := analytics.RunProcessID()
+	if err != nil {
+		log.Warnf("Failed to identify the run: %s", err)
+		return nil
+	}
+
+	markers, err := analytics.ReadRunMarkers()
+	if err != nil {
+		log.Warnf("Failed to read run markers: %s", err)
+	}
+	_, orphans := analytics.SplitRunMarkers(markers, pid, analytics.ProcessAlive)
+	reportAbortedBuilds(config, orphans)
+
+	marker, err := analytics.NewRunMarker(time.Now(), pid, os.Getenv)
+	if err != nil {
+		return err
+	}
+	return analytics.WriteRunMarker(marker)
+}
+
+// finishRun measures the build's queue time and startup overhead from its run marker,
+// removes the marker and reports the builds that never finished.
+func finishRun(config configs.ConfigModel, buildAnalytics *analytics.BuildAnalytics) {
+	markers, err := analytics.ReadRunMarkers()
+	if err != nil {
+		log.Warnf("Failed to read run markers: %s", err)
+		return
+	} else if len(markers) == 0 {
+		return
+	}
+
+	pid, err := analytics.RunProcessID()
+	if err != nil {
+		log.Warnf("Failed to identify the run: %s", err)
+		return
+	}
+
+	marker, orphans := analytics.SplitRunMarkers(markers, pid, analytics.ProcessAlive)
+	if marker != nil {
+		analytics.MeasureRunOverhead(buildAnalytics, *marker)
+		if err := marker.Remove(); err != nil {
+			log.Warnf("Failed to remove run marker: %s", err)
+		}
+	}
+
+	reportAbortedBuilds(config, orphans)
+}
+
+func reportAbortedBuilds(config configs.ConfigModel, markers []analytics.RunMarker) {
+	for _, marker := range markers {
+		log.Warnf("Reporting the build of workflow %s started at %s as aborted", marker.WorkflowName, marker.StartTime.Format(time.RFC3339))
+		if err := deliverAnalytics(config, marker.AbortedBuildAnalytics(), false); err != nil && err != errAlreadyDelivered {
+			log.Warnf("Failed to send analytics of aborted build: %s", err)
+		}
+		// the build is reported once, even if sending failed
+		if err := marker.Remove(); err != nil {
+			log.Warnf("Failed to remove run marker: %s", err)
+		}
+	}
 }
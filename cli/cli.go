@@ -1,14 +1,15 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
 	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
 	"github.com/bitrise-io/bitrise-plugins-analytics/version"
 	bitriseConfigs "github.com/bitrise-io/bitrise/configs"
-	"github.com/bitrise-io/bitrise/models"
 	"github.com/bitrise-io/bitrise/plugins"
 	log "github.com/bitrise-io/go-utils/log"
 	"github.com/urfave/cli"
@@ -17,6 +18,12 @@ import (
 var commands = []cli.Command{
 	createSwitchCommand(true),
 	createSwitchCommand(false),
+	renderWebhookCommand,
+	historyCommand,
+	pipelineCommand,
+	validateCommand,
+	sendCommand,
+	importCommand,
 }
 
 var flags = []cli.Flag{
@@ -25,6 +32,18 @@ var flags = []cli.Flag{
 		Usage:  "Log level (options: debug, info, warn, error, fatal, panic).",
 		EnvVar: "LOGLEVEL",
 	},
+	cli.StringFlag{
+		Name:  "source",
+		Usage: "Payload source (options: stdin, env, file), detected if not set.",
+	},
+	cli.StringFlag{
+		Name:  "payload-file",
+		Usage: "Build run results payload file (JSON or YAML), read by the file source.",
+	},
+	cli.BoolFlag{
+		Name:  "force",
+		Usage: "Send the build to the collector even if the ledger records it as delivered.",
+	},
 }
 
 func before(c *cli.Context) error {
@@ -54,23 +73,32 @@ func action(c *cli.Context) {
 		return
 	}
 
-	if warn, err := checkFormatVersion(os.Getenv(plugins.PluginConfigFormatVersionKey), models.Version); err != nil {
+	if plugins.TriggerEventName(os.Getenv(plugins.PluginConfigTriggerEventKey)) == analytics.WillStartRunEvent {
+		if err := startRun(); err != nil {
+			log.Warnf("Failed to record the start of the run: %s", err)
+		}
+		return
+	}
+
+	hostFormatVersion := os.Getenv(plugins.PluginConfigFormatVersionKey)
+	compatibility, err := checkFormatVersion(hostFormatVersion)
+	if err != nil {
 		failf(err.Error())
-	} else if len(warn) > 0 {
-		log.Warnf(warn)
+	}
+	if msg := compatibility.message(hostFormatVersion); msg != "" {
+		log.Warnf(msg)
+	}
+	if compatibility.support == formatSupportRefused {
+		return
 	}
 
-	var t SourceType
-	if available, err := hasContent(os.Stdin); err != nil {
-		failf("Failed to check if analytics enabled: %s", err.Error())
-	} else if available {
-		log.Debugf("stdin payload provided")
-		t = StdinSource
-	} else if os.Getenv(configs.PluginConfigPayloadKey) != "" {
-		log.Debugf("env payload provided")
-		t = EnvSource
-	} else {
-		log.Errorf("No stdin data nor env data provided: only Bitrise CLI is intended to send build run analytics")
+	t, err := payloadSourceType(c.String("source"), c.String("payload-file"))
+	if err != nil {
+		if err == errNoPayloadSource {
+			log.Errorf("No stdin data nor env data provided: only Bitrise CLI is intended to send build run analytics")
+		} else {
+			log.Errorf("%s", err)
+		}
 
 		if err := cli.ShowAppHelp(c); err != nil {
 			failf("Failed to show help, error: %s", err)
@@ -80,12 +108,53 @@ func action(c *cli.Context) {
 		return
 	}
 
-	source := PayloadSourceFactory(t)
-	if err := sendAnalytics(source); err != nil {
+	decoder, err := analytics.NewPayloadDecoder(compatibility.decoder)
+	if err != nil {
+		failf("Failed to select payload decoder: %s", err)
+	}
+
+	config, err := configs.ReadConfig()
+	if err != nil {
+		failf("Failed to read analytics configuration: %s", err)
+	}
+
+	source, err := PayloadSourceFactory(t, PayloadSourceOptions{
+		PayloadFile: c.String("payload-file"),
+		MaxSize:     config.MaxPayloadSize,
+		Decoder:     decoder,
+	})
+	if err != nil {
+		failf("Failed to create payload source: %s", err)
+	}
+	if err := sendAnalytics(source, c.Bool("force")); err != nil {
 		failf("Failed to send analytics: %s", err)
 	}
 }
 
+var errNoPayloadSource = errors.New("no payload source detected")
+
+// payloadSourceType returns the source set by the flags, or detects it if not set:
+// the payload file if set, stdin if it has content or the payload env.
+func payloadSourceType(source, payloadFile string) (SourceType, error) {
+	if source != "" {
+		return ParseSourceType(source)
+	}
+	if payloadFile != "" {
+		return FileSource, nil
+	}
+
+	if available, err := hasContent(os.Stdin); err != nil {
+		return 0, fmt.Errorf("failed to check stdin: %s", err)
+	} else if available {
+		log.Debugf("stdin payload provided")
+		return StdinSource, nil
+	} else if os.Getenv(configs.PluginConfigPayloadKey) != "" {
+		log.Debugf("env payload provided")
+		return EnvSource, nil
+	}
+	return 0, errNoPayloadSource
+}
+
 func createApp() *cli.App {
 	app := cli.NewApp()
 
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	ver "github.com/hashicorp/go-version"
+	"github.com/pkg/errors"
+)
+
+// minBitriseCLIVersion points to the version of Bitrise CLI introduceses Bitrise plugins.
+const minBitriseCLIVersion = "1.6.0"
+
+// formatSupport tells how the plugin handles the payloads of a host format version.
+type formatSupport string
+
+const (
+	// formatSupportFull: every field the plugin reads is decoded.
+	formatSupportFull formatSupport = "full"
+	// formatSupportDegraded: the payload is sent, without the missing fields.
+	formatSupportDegraded formatSupport = "degraded"
+	// formatSupportRefused: the payload is not sent.
+	formatSupportRefused formatSupport = "refused"
+)
+
+// formatCompatibility describes how the payloads of a range of host format versions are handled.
+type formatCompatibility struct {
+	// minVersion is inclusive, maxVersion is exclusive, empty bounds are open.
+	minVersion string
+	maxVersion string
+	support    formatSupport
+	// decoder is the format version of the payload decoder.
+	decoder       string
+	missingFields []string
+}
+
+// formatCompatibilities is the compatibility table of the host Bitrise CLI's format versions.
+var formatCompatibilities = []formatCompatibility{
+	{
+		// formats of the CLIs before the plugins were introduced
+		maxVersion: "1.4.0",
+		support:    formatSupportRefused,
+	},
+	{
+		minVersion:    "1.4.0",
+		maxVersion:    "11",
+		support:       formatSupportDegraded,
+		decoder:       "11",
+		missingFields: []string{"step_inputs", "step start_time"},
+	},
+	{
+		minVersion: "11",
+		maxVersion: "12",
+		support:    formatSupportFull,
+		decoder:    "11",
+	},
+	{
+		// newer formats are decoded as format version 11, their new fields are kept in the extras
+		minVersion:    "12",
+		support:       formatSupportDegraded,
+		decoder:       "11",
+		missingFields: []string{"fields added after format version 11"},
+	},
+}
+
+// missingFormatVersionCompatibility is used for hosts not reporting their format version.
+var missingFormatVersionCompatibility = formatCompatibility{
+	support: formatSupportDegraded,
+	decoder: analytics.DefaultPayloadFormatVersion,
+}
+
+func (c formatCompatibility) contains(version *ver.Version) bool {
+	if c.minVersion != "" && version.LessThan(ver.Must(ver.NewVersion(c.minVersion))) {
+		return false
+	}
+	if c.maxVersion != "" && !version.LessThan(ver.Must(ver.NewVersion(c.maxVersion))) {
+		return false
+	}
+	return true
+}
+
+// checkFormatVersion looks up the host Bitrise CLI's format version in the compatibility table.
+func checkFormatVersion(hostBitriseFormatVersionStr string) (formatCompatibility, error) {
+	if hostBitriseFormatVersionStr == "" {
+		return missingFormatVersionCompatibility, nil
+	}
+
+	hostBitriseFormatVersion, err := ver.NewVersion(hostBitriseFormatVersionStr)
+	if err != nil {
+		return formatCompatibility{}, errors.Wrapf(err, "failed to parse bitrise format version (%s)", hostBitriseFormatVersionStr)
+	}
+
+	for _, compatibility := range formatCompatibilities {
+		if compatibility.contains(hostBitriseFormatVersion) {
+			return compatibility, nil
+		}
+	}
+	return formatCompatibility{}, errors.Errorf("bitrise format version (%s) is not in the compatibility table", hostBitriseFormatVersionStr)
+}
+
+// message describes the compatibility for the build log, it is empty for full support.
+func (c formatCompatibility) message(hostBitriseFormatVersionStr string) string {
+	switch {
+	case hostBitriseFormatVersionStr == "":
+		return fmt.Sprintf("This analytics plugin version would need bitrise-cli version >= %s to submit analytics", minBitriseCLIVersion)
+	case c.support == formatSupportRefused:
+		return fmt.Sprintf("Outdated bitrise-cli, format version %s is not supported by the analytics plugin, please update the bitrise-cli", hostBitriseFormatVersionStr)
+	case c.support == formatSupportDegraded:
+		return fmt.Sprintf("The analytics plugin partially supports bitrise-cli format version %s, these fields are not submitted: %s", hostBitriseFormatVersionStr, strings.Join(c.missingFields, ", "))
+	}
+	return ""
+}
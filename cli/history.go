@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/urfave/cli"
+)
+
+var historyCommand = cli.Command{
+	Name:  "history",
+	Usage: "List the builds recorded in the local history.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "workflow",
+			Usage: "Only list the builds of the workflow.",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "Only list the builds with the label (key=value), can be repeated.",
+		},
+		cli.IntFlag{
+			Name:  "limit",
+			Value: 20,
+			Usage: "Maximum number of builds to list, the most recent ones are listed.",
+		},
+	},
+	Action: func(c *cli.Context) {
+		filter := analytics.HistoryFilter{
+			Workflow: c.String("workflow"),
+			Labels:   map[string]string{},
+		}
+		for _, labelFilter := range c.StringSlice("label") {
+			key, value, err := analytics.ParseLabelFilter(labelFilter)
+			if err != nil {
+				failf("Failed to parse label filter: %s", err)
+			}
+			filter.Labels[key] = value
+		}
+
+		if err := listHistory(filter, c.Int("limit")); err != nil {
+			failf("Failed to list history: %s", err)
+		}
+	},
+}
+
+func listHistory(filter analytics.HistoryFilter, limit int) error {
+	history, err := analytics.ReadHistory()
+	if err != nil {
+		return err
+	}
+
+	var builds []analytics.BuildAnalytics
+	for _, buildAnalytics := range history {
+		if filter.Match(buildAnalytics) {
+			builds = append(builds, buildAnalytics)
+		}
+	}
+	if limit > 0 && len(builds) > limit {
+		builds = builds[len(builds)-limit:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START TIME\tWORKFLOW\tSTATUS\tRUN TIME\tBUILD\tLABELS")
+	for _, buildAnalytics := range builds {
+		var labels []string
+		for key, value := range buildAnalytics.Labels {
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			buildAnalytics.StartTime.Format(time.RFC3339),
+			buildAnalytics.WorkflowName,
+			buildAnalytics.Status,
+			buildAnalytics.Runtime.Round(time.Second),
+			buildAnalytics.BuildSlug,
+			strings.Join(labels, ","),
+		)
+	}
+	return w.Flush()
+}
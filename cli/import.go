@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	log "github.com/bitrise-io/go-utils/log"
+	"github.com/urfave/cli"
+)
+
+var importCommand = cli.Command{
+	Name:      "import",
+	Usage:     "Load a directory of archived build run results files into the local history, without sending them.",
+	ArgsUsage: "DIRECTORY",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "sink",
+			Usage: "Sink the loaded builds are exported to (options: statsd, influxdb, elasticsearch, syslog, webhook:WEBHOOK_NAME).",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Value: 4,
+			Usage: "Maximum number of builds exported to the sink at a time.",
+		},
+	},
+	Action: func(c *cli.Context) {
+		if err := importHistory(c.Args().First(), c.String("sink"), c.Int("concurrency")); err != nil {
+			failf("Failed to import build run results: %s", err)
+		}
+	},
+}
+
+// importProgressInterval is the number of files between two progress reports.
+const importProgressInterval = 100
+
+// importSummary counts the results of an import.
+type importSummary struct {
+	imported   int
+	duplicates int
+	// badFiles are the files skipped, with their errors.
+	badFiles []string
+}
+
+// importHistory records the builds of the payload files in the directory in the local history,
+// the builds already recorded are skipped. The builds are exported to the sink if its name is set,
+// except the ones already exported to it.
+func importHistory(dir, sinkName string, concurrency int) error {
+	if dir == "" {
+		return fmt.Errorf("directory not provided")
+	}
+
+	config, err := configs.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read analytics configuration: %s", err)
+	}
+	// the builds are exported as archived builds, without the webhooks triggered on status change
+	config = archivedDeliveryConfig(config)
+
+	var sink analytics.Sink
+	if sinkName != "" {
+		if sink, err = analytics.SinkByName(config, sinkName); err != nil {
+			return err
+		}
+	}
+
+	files, err := payloadFilesInDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list payload files: %s", err)
+	}
+
+	history, err := analytics.ReadHistory()
+	if err != nil {
+		return fmt.Errorf("failed to read the local history: %s", err)
+	}
+
+	var (
+		summary importSummary
+		builds  []analytics.BuildAnalytics
+	)
+	for i, pth := range files {
+		buildAnalytics, err := importPayloadFile(config, pth)
+		if err != nil {
+			summary.badFiles = append(summary.badFiles, fmt.Sprintf("%s: %s", pth, err))
+		} else {
+			if !analytics.IsRecorded(builds, buildAnalytics) {
+				builds = append(builds, buildAnalytics)
+			}
+
+			if analytics.IsRecorded(history, buildAnalytics) {
+				summary.duplicates++
+			} else if err := analytics.AppendHistory(buildAnalytics); err != nil {
+				return fmt.Errorf("failed to record build in the local history: %s", err)
+			} else {
+				history = append(history, buildAnalytics)
+				summary.imported++
+			}
+		}
+
+		if (i+1)%importProgressInterval == 0 || i+1 == len(files) {
+			log.Infof("Processed %d/%d files", i+1, len(files))
+		}
+	}
+
+	log.Infof("Imported %d builds, skipped %d builds already recorded and %d bad files", summary.imported, summary.duplicates, len(summary.badFiles))
+	for _, badFile := range summary.badFiles {
+		log.Warnf("Skipped %s", badFile)
+	}
+
+	if sink == nil || len(builds) == 0 {
+		return nil
+	}
+	exportBuilds(sink, builds, concurrency)
+	return nil
+}
+
+// exportBuilds sends the builds not recorded in the ledger as delivered to the sink,
+// and records the builds sent, so exporting the same builds again does not send them twice.
+func exportBuilds(sink analytics.Sink, builds []analytics.BuildAnalytics, concurrency int) {
+	destination := analytics.SinkDestination(sink.Name())
+
+	var pending []analytics.BuildAnalytics
+	for _, buildAnalytics := range builds {
+		buildAnalytics.SubmissionID = analytics.NewSubmissionID(buildAnalytics)
+		if buildAnalytics.SubmissionID != "" {
+			if delivered, err := analytics.DeliveredDestinations(buildAnalytics.SubmissionID); err != nil {
+				log.Warnf("Failed to check the ledger of delivered builds: %s", err)
+			} else if delivered[destination] {
+				continue
+			}
+		}
+		pending = append(pending, buildAnalytics)
+	}
+
+	exported := 0
+	for i, err := range analytics.ExportToSink(sink, pending, concurrency) {
+		if err != nil {
+			log.Warnf("Failed to export build (%s) to %s: %s", pending[i].StartTime.Format(time.RFC3339), sink.Name(), err)
+			continue
+		}
+		exported++
+		recordDelivery(pending[i], destination)
+	}
+	log.Infof("Exported %d/%d builds to %s, skipped %d builds already exported", exported, len(pending), sink.Name(), len(builds)-len(pending))
+}
+
+// payloadFilesInDir returns the JSON and YAML files of the directory and its subdirectories, in lexical order.
+func payloadFilesInDir(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(pth)) {
+		case ".json", ".yml", ".yaml":
+			files = append(files, pth)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// importPayloadFile returns the build analytics of the payload file, with the build's metadata archived in the payload.
+func importPayloadFile(config configs.ConfigModel, pth string) (analytics.BuildAnalytics, error) {
+	payload, err := FilePayloadSource{pth: pth}.Payload()
+	if err != nil {
+		return analytics.BuildAnalytics{}, err
+	}
+
+	buildAnalytics, send, err := newBuildAnalytics(config, payload)
+	if err != nil {
+		return analytics.BuildAnalytics{}, err
+	} else if !send {
+		return analytics.BuildAnalytics{}, fmt.Errorf("dropped by the validation policy")
+	}
+
+	if err := applyArchivedMetadata(&buildAnalytics, payload.Extras); err != nil {
+		return analytics.BuildAnalytics{}, err
+	}
+	return buildAnalytics, nil
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestImportHistory(t *testing.T) {
+	dataDir, err := pathutil.NormalizedOSTempDirPath("import")
+	require.NoError(t, err)
+	archiveDir, err := pathutil.NormalizedOSTempDirPath("archive")
+	require.NoError(t, err)
+
+	var requests, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	config, err := yaml.Marshal(configs.ConfigModel{Webhooks: []configs.WebhookConfigModel{
+		{Name: "archive", URL: server.URL},
+		{Name: "status", URL: server.URL, Trigger: configs.WebhookTriggerOnStatusChange},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "config.yml"), config, 0644))
+
+	configs.DataDir = dataDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	// the environment of the import is not the builds'
+	require.NoError(t, os.Setenv("BITRISE_APP_SLUG", "env-app-slug"))
+	defer func() {
+		require.NoError(t, os.Unsetenv("BITRISE_APP_SLUG"))
+	}()
+
+	otherBuildPayload := strings.Replace(failedBuildPayload, "2027588963", "1027588963", 1)
+	files := map[string]string{
+		"2020/10/build.json":       failedBuildPayload,
+		"2020/10/copy.yml":         failedBuildYAMLPayload,
+		"2020/11/other.json":       otherBuildPayload,
+		"2020/11/with-slug.json":   strings.Replace(otherBuildPayload, `"success_steps"`, `"build_slug": "slug", "app_slug": "app-slug", "success_steps"`, 1),
+		"2020/11/invalid.json":     "{",
+		"2020/11/build.log":        "not a payload",
+		"2020/12/empty/empty.json": "",
+	}
+	for name, content := range files {
+		pth := filepath.Join(archiveDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+		require.NoError(t, ioutil.WriteFile(pth, []byte(content), 0644))
+	}
+
+	require.NoError(t, importHistory(archiveDir, "webhook:archive", 2))
+	history, err := analytics.ReadHistory()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(history))
+	require.Empty(t, history[0].AppSlug)
+	require.Equal(t, "slug", history[2].BuildSlug)
+	require.Equal(t, "app-slug", history[2].AppSlug)
+	// the duplicated build is exported once
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// the builds are recorded and exported once
+	require.NoError(t, importHistory(archiveDir, "webhook:archive", 2))
+	history, err = analytics.ReadHistory()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(history))
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// the builds which failed to export are exported again
+	require.NoError(t, ioutil.WriteFile(filepath.Join(archiveDir, "2020/12/new.json"), []byte(strings.Replace(failedBuildPayload, "2027588963", "3027588963", 1)), 0644))
+	atomic.StoreInt32(&failures, 1)
+	require.NoError(t, importHistory(archiveDir, "webhook:archive", 1))
+	require.Equal(t, int32(4), atomic.LoadInt32(&requests))
+	require.NoError(t, importHistory(archiveDir, "webhook:archive", 1))
+	require.Equal(t, int32(5), atomic.LoadInt32(&requests))
+	require.NoError(t, importHistory(archiveDir, "webhook:archive", 1))
+	require.Equal(t, int32(5), atomic.LoadInt32(&requests))
+
+	// the webhooks triggered on status change do not get archived builds
+	require.Error(t, importHistory(archiveDir, "webhook:status", 0))
+	require.Error(t, importHistory(archiveDir, "webhook:missing", 0))
+	require.Error(t, importHistory(filepath.Join(archiveDir, "missing"), "", 0))
+}
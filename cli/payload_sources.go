@@ -1,71 +1,271 @@
 package cli
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 
-	"github.com/bitrise-io/bitrise/models"
+	"gopkg.in/yaml.v2"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
 )
 
 // EnvPayloadSource ...
 type EnvPayloadSource struct {
 	envValue string
+	decoder  analytics.PayloadDecoder
 }
 
 // Payload ...
-func (s EnvPayloadSource) Payload() (models.BuildRunResultsModel, error) {
+func (s EnvPayloadSource) Payload() (analytics.BuildRunResults, error) {
 	if s.envValue == "" {
-		return models.BuildRunResultsModel{}, errNoInput
+		return analytics.BuildRunResults{}, errNoInput
 	}
 
-	var payload models.BuildRunResultsModel
-	if err := json.Unmarshal([]byte(s.envValue), &payload); err != nil {
-		return models.BuildRunResultsModel{}, err
+	payload, err := decode(s.decoder, []byte(s.envValue))
+	if err != nil {
+		return analytics.BuildRunResults{}, err
 	}
 	return payload, nil
 }
 
-// StdinPayloadSource ....
+// defaultMaxPayloadSize is the maximum size of the stdin payload if it is not configured.
+const defaultMaxPayloadSize = 16 * 1024 * 1024
+
+// payloadExcerptLength is the number of bytes shown around the position of a parse error.
+const payloadExcerptLength = 32
+
+// StdinPayloadSource streams the payload from the reader into the model through a size-limited JSON decoder,
+// which stops reading past the maximum size and locates the parse errors.
 type StdinPayloadSource struct {
-	reader io.Reader
+	reader  io.Reader
+	decoder analytics.PayloadDecoder
+	// maxSize is the maximum payload size in bytes, defaultMaxPayloadSize if not set.
+	maxSize int64
 }
 
 var errNoInput = errors.New("nothing to read")
 
 // Payload ....
-func (s StdinPayloadSource) Payload() (models.BuildRunResultsModel, error) {
-	b, err := read(s.reader)
+func (s StdinPayloadSource) Payload() (analytics.BuildRunResults, error) {
+	maxSize := s.maxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxPayloadSize
+	}
+
+	// reading one byte over the limit tells if the payload is too large
+	reader := &positionReader{reader: io.LimitReader(s.reader, maxSize+1)}
+	dec := json.NewDecoder(reader)
+
+	buildRunResults, err := decoderOrDefault(s.decoder)(dec)
+	if err != nil {
+		switch {
+		case reader.offset > maxSize:
+			return analytics.BuildRunResults{}, fmt.Errorf("payload exceeds the maximum size of %d bytes", maxSize)
+		case err == io.EOF:
+			return analytics.BuildRunResults{}, errNoInput
+		}
+		switch parseErr := err.(type) {
+		case *json.SyntaxError:
+			return analytics.BuildRunResults{}, fmt.Errorf("failed to parse plugin input at %s: %s", reader.locate(parseErr.Offset), err)
+		case *json.UnmarshalTypeError:
+			return analytics.BuildRunResults{}, fmt.Errorf("failed to parse plugin input at %s: %s", reader.locate(parseErr.Offset), err)
+		}
+		return analytics.BuildRunResults{}, fmt.Errorf("failed to parse plugin input: %s", err)
+	}
+
+	_, err = dec.Token()
+	if reader.offset > maxSize {
+		return analytics.BuildRunResults{}, fmt.Errorf("payload exceeds the maximum size of %d bytes", maxSize)
+	}
+	if err != io.EOF {
+		return analytics.BuildRunResults{}, fmt.Errorf("failed to parse plugin input: unexpected data after the payload at offset %d", dec.InputOffset())
+	}
+	return buildRunResults, nil
+}
+
+// positionReader counts the lines of the data read, to locate the parse errors without keeping the input.
+type positionReader struct {
+	reader io.Reader
+	// offset is the number of bytes read.
+	offset int64
+
+	// last is a copy of the last chunk read, the json.Decoder overwrites its buffer when it compacts it.
+	last      []byte
+	lastStart int64
+	// before is a copy of the end of the data read before the last chunk, for the excerpts.
+	before []byte
+	// end is a copy of the end of the data read.
+	end []byte
+	// line and lineStart are the (zero based) line and its offset at the start of the last chunk.
+	line      int
+	lineStart int64
+	// nextLine and nextLineStart are the line and its offset at the end of the last chunk.
+	nextLine      int
+	nextLineStart int64
+}
+
+func (r *positionReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.last, r.lastStart = append(r.last[:0], p[:n]...), r.offset
+		r.line, r.lineStart = r.nextLine, r.nextLineStart
+		r.nextLine, r.nextLineStart = countLines(r.last, r.lastStart, r.nextLine, r.nextLineStart)
+		r.offset += int64(n)
+
+		r.before = r.end
+		end := append(append([]byte{}, r.before...), r.last...)
+		if len(end) > payloadExcerptLength {
+			end = end[len(end)-payloadExcerptLength:]
+		}
+		r.end = end
+	}
+	return n, err
+}
+
+// locate describes the position of the offset, which is in the last chunk when decoding fails.
+func (r *positionReader) locate(offset int64) string {
+	if offset < r.lastStart || offset > r.offset {
+		return fmt.Sprintf("offset %d", offset)
+	}
+
+	pos := int(offset - r.lastStart)
+	context := append(append([]byte{}, r.before...), r.last...)
+	return describePosition(r.last[:pos], r.lastStart, r.line, r.lineStart, context, len(r.before)+pos)
+}
+
+// countLines returns the (zero based) line and its offset at the end of the chunk,
+// which starts at chunkStart in the line starting at lineStart.
+func countLines(chunk []byte, chunkStart int64, line int, lineStart int64) (int, int64) {
+	for i, b := range chunk {
+		if b == '\n' {
+			line++
+			lineStart = chunkStart + int64(i) + 1
+		}
+	}
+	return line, lineStart
+}
+
+// describePosition returns the line and column of the error and an excerpt of the context around it,
+// prefix is the data before the error in its chunk, ending with the erroneous byte.
+func describePosition(prefix []byte, chunkStart int64, line int, lineStart int64, context []byte, pos int) string {
+	if len(prefix) > 0 {
+		line, lineStart = countLines(prefix[:len(prefix)-1], chunkStart, line, lineStart)
+	}
+	column := chunkStart + int64(len(prefix)) - lineStart
+
+	start, end := pos-payloadExcerptLength, pos+payloadExcerptLength
+	if start < 0 {
+		start = 0
+	}
+	if end > len(context) {
+		end = len(context)
+	}
+	excerpt := strings.Join(strings.Fields(string(context[start:end])), " ")
+
+	return fmt.Sprintf("line %d, column %d (near %q)", line+1, column, excerpt)
+}
+
+// FilePayloadSource reads a JSON or YAML payload file.
+type FilePayloadSource struct {
+	pth     string
+	decoder analytics.PayloadDecoder
+}
+
+// Payload ...
+func (s FilePayloadSource) Payload() (analytics.BuildRunResults, error) {
+	b, err := ioutil.ReadFile(s.pth)
 	if err != nil {
-		return models.BuildRunResultsModel{}, err
+		return analytics.BuildRunResults{}, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return analytics.BuildRunResults{}, errNoInput
 	}
-	if len(b) == 0 {
-		return models.BuildRunResultsModel{}, errNoInput
+
+	if isYAMLPayload(s.pth, b) {
+		if b, err = yamlToJSON(b); err != nil {
+			return analytics.BuildRunResults{}, fmt.Errorf("failed to parse YAML payload file (%s): %s", s.pth, err)
+		}
 	}
 
-	var buildRunResults models.BuildRunResultsModel
-	if err := json.Unmarshal(b, &buildRunResults); err != nil {
-		return models.BuildRunResultsModel{}, fmt.Errorf("failed to parse plugin input (%s): %s", string(b), err)
+	buildRunResults, err := decode(s.decoder, b)
+	if err != nil {
+		return analytics.BuildRunResults{}, fmt.Errorf("failed to parse payload file (%s): %s", s.pth, err)
 	}
 	return buildRunResults, nil
 }
 
-func read(r io.Reader) ([]byte, error) {
-	var buff []byte
-	for {
-		chunk := make([]byte, 100)
-		n, err := r.Read(chunk)
-		if err != nil {
-			if err == io.EOF {
-				break
+// isYAMLPayload detects the payload's format from the file's extension,
+// or from its content if the extension is neither .json, .yml nor .yaml.
+func isYAMLPayload(pth string, content []byte) bool {
+	switch strings.ToLower(filepath.Ext(pth)) {
+	case ".json":
+		return false
+	case ".yml", ".yaml":
+		return true
+	}
+	// JSON payloads are objects
+	return !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{"))
+}
+
+// yamlToJSON converts a YAML document to JSON, so it can be decoded by the payload decoders.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	document, err := jsonCompatibleYAML(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// jsonCompatibleYAML converts the maps decoded from YAML, which can have non-string keys, to JSON objects.
+func jsonCompatibleYAML(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, value := range v {
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key: %v", key)
+			}
+			converted, err := jsonCompatibleYAML(value)
+			if err != nil {
+				return nil, err
 			}
-			return nil, err
+			object[keyStr] = converted
 		}
-		if n == 0 {
-			break
+		return object, nil
+	case []interface{}:
+		for i, item := range v {
+			converted, err := jsonCompatibleYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
 		}
-		buff = append(buff, chunk[:n]...)
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// decode decodes the payload with the decoder, or with the vendored models' format version's decoder if it is nil.
+func decode(decoder analytics.PayloadDecoder, payload []byte) (analytics.BuildRunResults, error) {
+	return decoderOrDefault(decoder).Decode(payload)
+}
+
+// decoderOrDefault returns the decoder, or the vendored models' format version's decoder if it is nil.
+func decoderOrDefault(decoder analytics.PayloadDecoder) analytics.PayloadDecoder {
+	if decoder == nil {
+		return analytics.DefaultPayloadDecoder()
 	}
-	return buff, nil
+	return decoder
 }
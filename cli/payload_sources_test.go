@@ -1,14 +1,20 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
 	"github.com/bitrise-io/bitrise/models"
+	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/pointers"
 	stepmanModels "github.com/bitrise-io/stepman/models"
 	"github.com/stretchr/testify/require"
@@ -74,31 +80,31 @@ func TestEnvPayloadSource(t *testing.T) {
 	tests := []struct {
 		name    string
 		e       string
-		want    models.BuildRunResultsModel
+		want    analytics.BuildRunResults
 		wantErr bool
 	}{
 		{
 			name:    "reading empty payload returns an error (no input provided)",
 			e:       "",
-			want:    models.BuildRunResultsModel{},
+			want:    analytics.BuildRunResults{},
 			wantErr: true,
 		},
 		{
 			name:    "reading invalid payload returns an error",
 			e:       "invalid json",
-			want:    models.BuildRunResultsModel{},
+			want:    analytics.BuildRunResults{},
 			wantErr: true,
 		},
 		{
 			name:    "parses valid payload",
 			e:       failedBuildPayload,
-			want:    faildBuildBuildRunResult,
+			want:    analytics.BuildRunResults{BuildRunResultsModel: faildBuildBuildRunResult},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := EnvPayloadSource{tt.e}.Payload()
+			got, err := EnvPayloadSource{envValue: tt.e}.Payload()
 			require.Equal(t, err != nil, tt.wantErr, fmt.Sprintf("expected error: %v, got: %v", tt.wantErr, err == nil))
 			require.Equal(t, tt.want, got)
 		})
@@ -109,25 +115,43 @@ func TestStdinPayloadSource(t *testing.T) {
 	tests := []struct {
 		name    string
 		r       io.Reader
-		want    models.BuildRunResultsModel
+		want    analytics.BuildRunResults
 		wantErr bool
 	}{
 		{
 			name:    "reading empty payload returns an error (no input provided)",
 			r:       strings.NewReader(""),
-			want:    models.BuildRunResultsModel{},
+			want:    analytics.BuildRunResults{},
 			wantErr: true,
 		},
 		{
 			name:    "reading invalid payload returns an error",
 			r:       strings.NewReader("invalid json"),
-			want:    models.BuildRunResultsModel{},
+			want:    analytics.BuildRunResults{},
 			wantErr: true,
 		},
+		{
+			name:    "reading payload followed by other data returns an error",
+			r:       strings.NewReader(failedBuildPayload + " {}"),
+			want:    analytics.BuildRunResults{},
+			wantErr: true,
+		},
+		{
+			name:    "reading payload over the maximum size returns an error",
+			r:       strings.NewReader(failedBuildPayload + strings.Repeat(" ", 1024)),
+			want:    analytics.BuildRunResults{},
+			wantErr: true,
+		},
+		{
+			name:    "parses valid payload",
+			r:       strings.NewReader(failedBuildPayload + "\n"),
+			want:    analytics.BuildRunResults{BuildRunResultsModel: faildBuildBuildRunResult},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := StdinPayloadSource{tt.r}.Payload()
+			got, err := StdinPayloadSource{reader: tt.r, maxSize: int64(len(failedBuildPayload) + 512)}.Payload()
 			require.Equal(t, err != nil, tt.wantErr, fmt.Sprintf("expected error: %v, got: %v", tt.wantErr, err == nil))
 			require.Equal(t, tt.want, got)
 		})
@@ -143,7 +167,204 @@ func TestStdinPayloadSourceReadsFromPipe(t *testing.T) {
 	require.Equal(t, len([]byte(failedBuildPayload)), n)
 	require.NoError(t, w.Close())
 
-	payload, err := StdinPayloadSource{r}.Payload()
+	payload, err := StdinPayloadSource{reader: r}.Payload()
+	require.NoError(t, err)
+	require.Equal(t, payload.BuildRunResultsModel, faildBuildBuildRunResult)
+}
+
+func TestStdinPayloadSourceExtras(t *testing.T) {
+	payload := strings.Replace(failedBuildPayload, `"idx":0,`, `"idx":0, "step_bundle": {"id": "setup"},`, 1)
+	payload = strings.Replace(payload, `"skipped_steps":null`, `"skipped_steps":null, "workflow_id": "primary"`, 1)
+
+	got, err := StdinPayloadSource{reader: strings.NewReader(payload)}.Payload()
+	require.NoError(t, err)
+	require.Equal(t, faildBuildBuildRunResult, got.BuildRunResultsModel)
+	require.Equal(t, map[string]json.RawMessage{"workflow_id": json.RawMessage(`"primary"`)}, got.Extras)
+	require.Equal(t, map[int]analytics.StepRunDetails{
+		0: {Extras: map[string]json.RawMessage{"step_bundle": json.RawMessage(`{"id": "setup"}`)}},
+	}, got.StepDetails)
+}
+
+func TestStdinPayloadSourceParseErrors(t *testing.T) {
+	invalidPayload := strings.Replace(failedBuildPayload, `"status":1,`, `"status":1,,`, 1)
+	_, err := StdinPayloadSource{reader: strings.NewReader(invalidPayload)}.Payload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 22, column 16")
+	require.Contains(t, err.Error(), `\"status\":1,, \"idx\":0,`)
+	require.NotContains(t, err.Error(), "stepman_updates")
+
+	// the error is located in the chunk read last
+	_, err = StdinPayloadSource{reader: iotest.OneByteReader(strings.NewReader(invalidPayload))}.Payload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 22, column 16")
+
+	invalidPayload = strings.Replace(failedBuildPayload, `"idx":0,`, `"idx":"0",`, 1)
+	_, err = StdinPayloadSource{reader: strings.NewReader(invalidPayload)}.Payload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 23, column 13")
+	require.NotContains(t, err.Error(), "stepman_updates")
+
+	invalidPayload = strings.Replace(failedBuildPayload, `"idx":0,`, `"idx": "0",`, 1)
+	_, err = StdinPayloadSource{reader: strings.NewReader(invalidPayload)}.Payload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 23, column 14")
+
+	_, err = StdinPayloadSource{reader: strings.NewReader(failedBuildPayload[:100])}.Payload()
+	require.EqualError(t, err, "failed to parse plugin input: unexpected EOF")
+}
+
+// largeBuildPayload returns a payload of a build running the given number of steps.
+func largeBuildPayload(steps int) string {
+	step := `{"step_info":{"id":"script","version":"1.1.3"},"status":0,"idx":%d,"run_time":2027588963}`
+	var stepList []string
+	for i := 0; i < steps; i++ {
+		stepList = append(stepList, fmt.Sprintf(step, i))
+	}
+	return fmt.Sprintf(`{"success_steps":[%s]}`, strings.Join(stepList, ",\n"))
+}
+
+// readInChunks reads the whole input in 100 bytes chunks, as the stdin payload source used to.
+func readInChunks(r io.Reader) ([]byte, error) {
+	var buff []byte
+	for {
+		chunk := make([]byte, 100)
+		n, err := r.Read(chunk)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		buff = append(buff, chunk[:n]...)
+	}
+	return buff, nil
+}
+
+// baselineStdinPayload is the stdin payload source before the streaming decoder: it reads the whole input,
+// unmarshals it into the vendored model, and includes the input in the parse errors.
+func baselineStdinPayload(r io.Reader) (models.BuildRunResultsModel, error) {
+	b, err := readInChunks(r)
+	if err != nil {
+		return models.BuildRunResultsModel{}, err
+	}
+	if len(b) == 0 {
+		return models.BuildRunResultsModel{}, errNoInput
+	}
+
+	var buildRunResults models.BuildRunResultsModel
+	if err := json.Unmarshal(b, &buildRunResults); err != nil {
+		return models.BuildRunResultsModel{}, fmt.Errorf("failed to parse plugin input (%s): %s", string(b), err)
+	}
+	return buildRunResults, nil
+}
+
+// benchmarkPayloads are a large build's payload and the same payload with a syntax error at its end.
+var benchmarkPayloads = map[string]string{
+	"valid":   largeBuildPayload(5000),
+	"invalid": largeBuildPayload(5000) + "}",
+}
+
+func BenchmarkStdinPayloadSource(b *testing.B) {
+	for name, payload := range benchmarkPayloads {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = StdinPayloadSource{reader: strings.NewReader(payload)}.Payload()
+			}
+		})
+	}
+}
+
+func BenchmarkBaselineStdinPayload(b *testing.B) {
+	for name, payload := range benchmarkPayloads {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _ = baselineStdinPayload(strings.NewReader(payload))
+			}
+		})
+	}
+}
+
+const failedBuildYAMLPayload = `stepman_updates:
+  https://github.com/bitrise-io/bitrise-steplib.git: 1
+failed_steps:
+- step_info:
+    library: https://github.com/bitrise-io/bitrise-steplib.git
+    id: script
+    version: 1.1.3
+    latest_version: 1.1.3
+    step:
+      title: script
+      source_code_url: https://github.com/bitrise-io/steps-script
+      support_url: https://github.com/bitrise-io/steps-script/issues
+  status: 1
+  idx: 0
+  run_time: 2027588963
+  error_str: exit status 1
+  exit_code: 1
+`
+
+func TestFilePayloadSource(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("payload")
 	require.NoError(t, err)
-	require.Equal(t, payload, faildBuildBuildRunResult)
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		wantErr  bool
+	}{
+		{name: "JSON file", fileName: "payload.json", content: failedBuildPayload},
+		{name: "YAML file", fileName: "payload.yml", content: failedBuildYAMLPayload},
+		{name: "JSON content", fileName: "payload", content: failedBuildPayload},
+		{name: "YAML content", fileName: "payload.txt", content: failedBuildYAMLPayload},
+		{name: "YAML in JSON file", fileName: "invalid.json", content: failedBuildYAMLPayload, wantErr: true},
+		{name: "empty file", fileName: "empty.json", content: " \n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pth := filepath.Join(tmpDir, tt.fileName)
+			require.NoError(t, ioutil.WriteFile(pth, []byte(tt.content), 0644))
+
+			got, err := FilePayloadSource{pth: pth}.Payload()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, faildBuildBuildRunResult, got.BuildRunResultsModel)
+		})
+	}
+
+	_, err = FilePayloadSource{pth: filepath.Join(tmpDir, "missing.json")}.Payload()
+	require.Error(t, err)
+}
+
+func TestPayloadSourceFactory(t *testing.T) {
+	for _, name := range []string{"stdin", "env", "file"} {
+		sourceType, err := ParseSourceType(name)
+		require.NoError(t, err)
+		require.Equal(t, name, sourceType.String())
+	}
+	_, err := ParseSourceType("http")
+	require.Error(t, err)
+
+	source, err := PayloadSourceFactory(StdinSource, PayloadSourceOptions{MaxSize: 1024})
+	require.NoError(t, err)
+	require.Equal(t, int64(1024), source.(StdinPayloadSource).maxSize)
+
+	source, err = PayloadSourceFactory(EnvSource, PayloadSourceOptions{})
+	require.NoError(t, err)
+	require.IsType(t, EnvPayloadSource{}, source)
+
+	source, err = PayloadSourceFactory(FileSource, PayloadSourceOptions{PayloadFile: "payload.yml"})
+	require.NoError(t, err)
+	require.Equal(t, FilePayloadSource{pth: "payload.yml"}, source)
+
+	_, err = PayloadSourceFactory(FileSource, PayloadSourceOptions{})
+	require.Error(t, err)
 }
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/urfave/cli"
+)
+
+var pipelineCommand = cli.Command{
+	Name:      "pipeline",
+	Usage:     "Show a pipeline's timeline rebuilt from the builds recorded in the local history.",
+	ArgsUsage: "PIPELINE_ID",
+	Action: func(c *cli.Context) {
+		if err := showPipeline(c.Args().First()); err != nil {
+			failf("Failed to show pipeline: %s", err)
+		}
+	},
+}
+
+func showPipeline(pipelineID string) error {
+	if pipelineID == "" {
+		return fmt.Errorf("pipeline id not provided")
+	}
+
+	history, err := analytics.ReadHistory()
+	if err != nil {
+		return err
+	}
+
+	timeline, err := analytics.NewPipelineTimeline(pipelineID, history)
+	if err != nil {
+		return err
+	}
+
+	title := timeline.ID
+	if timeline.Title != "" {
+		title = timeline.Title + " (" + timeline.ID + ")"
+	}
+	fmt.Printf("Pipeline %s\n", title)
+	fmt.Printf("Started at %s, took %s, %s idle between stages\n\n",
+		timeline.Start.Format(time.RFC3339), timeline.Duration().Round(time.Second), timeline.IdleTime().Round(time.Second))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tOFFSET\tRUN TIME\tIDLE BEFORE\tWORKFLOW\tSTATUS\tBUILD\tCRITICAL")
+	for _, stage := range timeline.Stages {
+		stageName := stage.Title
+		if stageName == "" {
+			stageName = stage.ID
+		}
+
+		for i, buildAnalytics := range stage.Builds {
+			idleBefore := ""
+			if i == 0 {
+				idleBefore = stage.IdleBefore.Round(time.Second).String()
+			}
+			critical := ""
+			if i == stage.CriticalBuild {
+				critical = "*"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				stageName,
+				buildAnalytics.StartTime.Sub(timeline.Start).Round(time.Second),
+				buildAnalytics.Runtime.Round(time.Second),
+				idleBefore,
+				buildAnalytics.WorkflowName,
+				buildAnalytics.Status,
+				buildAnalytics.BuildSlug,
+				critical,
+			)
+		}
+	}
+	return w.Flush()
+}
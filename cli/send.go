@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/urfave/cli"
+)
+
+var sendCommand = cli.Command{
+	Name:      "send",
+	Usage:     "Send archived build run results payload files, the builds already delivered are skipped.",
+	ArgsUsage: "PAYLOAD_FILE_OR_GLOB...",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "app-slug",
+			Usage: "App slug of the builds, overrides the payload's.",
+		},
+		cli.StringFlag{
+			Name:  "stack",
+			Usage: "Stack ID of the builds, overrides the payload's.",
+		},
+		cli.StringFlag{
+			Name:  "workflow",
+			Usage: "Workflow of the builds, overrides the payload's.",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Send the builds recorded in the ledger as delivered to the collector again.",
+		},
+	},
+	Action: func(c *cli.Context) {
+		overrides := buildOverrides{
+			AppSlug:  c.String("app-slug"),
+			StackID:  c.String("stack"),
+			Workflow: c.String("workflow"),
+		}
+		if err := sendPayloadFiles(c.Args(), overrides, c.Bool("force")); err != nil {
+			failf("Failed to send payload files: %s", err)
+		}
+	},
+}
+
+// buildOverrides are the build metadata set for the sent payloads, empty fields are not overridden.
+type buildOverrides struct {
+	AppSlug  string
+	StackID  string
+	Workflow string
+}
+
+func (o buildOverrides) apply(buildAnalytics *analytics.BuildAnalytics) {
+	if o.AppSlug != "" {
+		buildAnalytics.AppSlug = o.AppSlug
+	}
+	if o.StackID != "" {
+		buildAnalytics.StackID = o.StackID
+	}
+	if o.Workflow != "" {
+		buildAnalytics.WorkflowName = o.Workflow
+	}
+}
+
+// archivedMetadata is the build's metadata archived with the build run results,
+// under the field names of the build analytics.
+type archivedMetadata struct {
+	AppSlug        string                     `json:"app_slug"`
+	BuildSlug      string                     `json:"build_slug"`
+	RepositoryID   string                     `json:"repo_id"`
+	StackID        string                     `json:"stack_id"`
+	CLIVersion     string                     `json:"cli_version"`
+	WorkflowName   string                     `json:"workflow_name"`
+	TriggerContext *analytics.TriggerContext  `json:"trigger_context"`
+	Pipeline       *analytics.PipelineContext `json:"pipeline"`
+	Labels         map[string]string          `json:"labels"`
+}
+
+// applyArchivedMetadata replaces the build's metadata read from the environment with the metadata
+// archived in the payload's extras, as the environment of the command is not the build's.
+func applyArchivedMetadata(buildAnalytics *analytics.BuildAnalytics, extras map[string]json.RawMessage) error {
+	var metadata archivedMetadata
+	if len(extras) > 0 {
+		content, err := json.Marshal(extras)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(content, &metadata); err != nil {
+			return fmt.Errorf("invalid build metadata: %s", err)
+		}
+	}
+
+	buildAnalytics.AppSlug = metadata.AppSlug
+	buildAnalytics.BuildSlug = metadata.BuildSlug
+	buildAnalytics.RepositoryID = metadata.RepositoryID
+	buildAnalytics.StackID = metadata.StackID
+	buildAnalytics.CLIVersion = metadata.CLIVersion
+	buildAnalytics.WorkflowName = metadata.WorkflowName
+	buildAnalytics.TriggerContext = metadata.TriggerContext
+	buildAnalytics.Pipeline = metadata.Pipeline
+	buildAnalytics.Labels = metadata.Labels
+	return nil
+}
+
+// archivedDeliveryConfig returns the config without the webhooks triggered on status change:
+// they track the status of the latest build of each workflow, which an archived build is not.
+func archivedDeliveryConfig(config configs.ConfigModel) configs.ConfigModel {
+	var webhooks []configs.WebhookConfigModel
+	for _, webhook := range config.Webhooks {
+		if webhook.Trigger != configs.WebhookTriggerOnStatusChange {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	config.Webhooks = webhooks
+	return config
+}
+
+// Results of sending a payload file
+const (
+	sendResultSent    = "sent"
+	sendResultSkipped = "skipped"
+	sendResultDropped = "dropped"
+	sendResultFailed  = "failed"
+)
+
+// expandPayloadFiles returns the files matching the paths or globs, each file once, in the order of the patterns.
+func expandPayloadFiles(patterns []string) ([]string, error) {
+	var (
+		files []string
+		seen  = map[string]bool{}
+	)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload file pattern (%s): %s", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no payload file matches: %s", pattern)
+		}
+
+		for _, match := range matches {
+			absPth, err := filepath.Abs(match)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[absPth] {
+				seen[absPth] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// sendPayloadFiles sends the payload files through the same pipeline as the payloads of the Bitrise CLI,
+// and prints the result of each file. It fails if any of the files failed.
+// The builds recorded in the ledger of delivered builds are skipped unless force is set.
+func sendPayloadFiles(patterns []string, overrides buildOverrides, force bool) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("payload file not provided")
+	}
+
+	files, err := expandPayloadFiles(patterns)
+	if err != nil {
+		return err
+	}
+
+	config, err := configs.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read analytics configuration: %s", err)
+	}
+	config = archivedDeliveryConfig(config)
+
+	failed := 0
+	for _, pth := range files {
+		result, err := sendPayloadFile(config, pth, overrides, force)
+		if err != nil {
+			failed++
+			fmt.Printf("%s: %s (%s)\n", pth, result, err)
+			continue
+		}
+		fmt.Printf("%s: %s\n", pth, result)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d payload files failed", failed, len(files))
+	}
+	return nil
+}
+
+// sendPayloadFile sends the payload file, unless its build is recorded in the ledger of delivered builds and force is not set.
+// The build's metadata is read from the payload, the data collected from a build's environment is not added to it.
+func sendPayloadFile(config configs.ConfigModel, pth string, overrides buildOverrides, force bool) (string, error) {
+	payload, err := FilePayloadSource{pth: pth}.Payload()
+	if err != nil {
+		return sendResultFailed, err
+	}
+
+	buildAnalytics, send, err := newBuildAnalytics(config, payload)
+	if err != nil {
+		return sendResultFailed, err
+	} else if !send {
+		return sendResultDropped, nil
+	}
+	if err := applyArchivedMetadata(&buildAnalytics, payload.Extras); err != nil {
+		return sendResultFailed, err
+	}
+	overrides.apply(&buildAnalytics)
+
+	if err := deliverAnalytics(config, buildAnalytics, force); err == errAlreadyDelivered {
+		return sendResultSkipped, nil
+	} else if err != nil {
+		return sendResultFailed, err
+	}
+	return sendResultSent, nil
+}
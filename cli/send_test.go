@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandPayloadFiles(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("send")
+	require.NoError(t, err)
+	for _, name := range []string{"a.json", "b.json", "c.yml"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(failedBuildPayload), 0644))
+	}
+
+	files, err := expandPayloadFiles([]string{filepath.Join(tmpDir, "b.json"), filepath.Join(tmpDir, "*.json")})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(tmpDir, "b.json"), filepath.Join(tmpDir, "a.json")}, files)
+
+	_, err = expandPayloadFiles([]string{filepath.Join(tmpDir, "*.yaml")})
+	require.Error(t, err)
+}
+
+func TestSendPayloadFile(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("send")
+	require.NoError(t, err)
+	pth := filepath.Join(tmpDir, "build.json")
+	require.NoError(t, ioutil.WriteFile(pth, []byte(failedBuildPayload), 0644))
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	// the environment of the command is not the build's
+	require.NoError(t, os.Setenv("BITRISEIO_STACK_ID", "env-stack"))
+	require.NoError(t, os.Setenv("BITRISE_BUILD_SLUG", "env-build-slug"))
+	defer func() {
+		require.NoError(t, os.Unsetenv("BITRISEIO_STACK_ID"))
+		require.NoError(t, os.Unsetenv("BITRISE_BUILD_SLUG"))
+	}()
+
+	var (
+		received        []analytics.BuildAnalytics
+		idempotencyKeys []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Data analytics.BuildAnalytics `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event.Data)
+		idempotencyKeys = append(idempotencyKeys, r.Header.Get("Idempotency-Key"))
+	}))
+	defer server.Close()
+
+	var webhookRequests int
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookRequests++
+	}))
+	defer webhookServer.Close()
+
+	config := configs.ConfigModel{
+		CloudEvents: &configs.CloudEventsConfigModel{URL: server.URL},
+		Webhooks:    []configs.WebhookConfigModel{{Name: "archive", URL: webhookServer.URL}},
+	}
+	overrides := buildOverrides{AppSlug: "app-slug", Workflow: "primary"}
+
+	result, err := sendPayloadFile(config, pth, overrides, false)
+	require.NoError(t, err)
+	require.Equal(t, sendResultSent, result)
+	require.Equal(t, 1, len(received))
+	require.Equal(t, "app-slug", received[0].AppSlug)
+	require.Equal(t, "primary", received[0].WorkflowName)
+	require.Empty(t, received[0].StackID)
+	require.Empty(t, received[0].BuildSlug)
+	require.NotEmpty(t, received[0].SubmissionID)
+	require.Equal(t, received[0].PayloadHash, received[0].SubmissionID)
+	require.Equal(t, received[0].SubmissionID, idempotencyKeys[0])
+
+	// re-sending the same build is skipped
+	result, err = sendPayloadFile(config, pth, overrides, false)
+	require.NoError(t, err)
+	require.Equal(t, sendResultSkipped, result)
+	require.Equal(t, 1, len(received))
+
+	recorded, err := analytics.ReadHistory()
+	require.NoError(t, err)
+	require.True(t, analytics.IsRecorded(recorded, received[0]))
+
+	// the build is sent to the collector again if forced, it is recorded and sent to the sinks once
+	result, err = sendPayloadFile(config, pth, overrides, true)
+	require.NoError(t, err)
+	require.Equal(t, sendResultSent, result)
+	require.Equal(t, 2, len(received))
+	require.Equal(t, 1, webhookRequests)
+	recorded, err = analytics.ReadHistory()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(recorded))
+
+	// another build is sent
+	otherPth := filepath.Join(tmpDir, "other.json")
+	require.NoError(t, ioutil.WriteFile(otherPth, []byte(strings.Replace(failedBuildPayload, "2027588963", "1027588963", 1)), 0644))
+	result, err = sendPayloadFile(config, otherPth, overrides, false)
+	require.NoError(t, err)
+	require.Equal(t, sendResultSent, result)
+	require.Equal(t, 3, len(received))
+
+	// the metadata archived with the build is sent, the flags override it
+	archivedPth := filepath.Join(tmpDir, "archived.json")
+	archived := strings.Replace(failedBuildPayload, `"success_steps"`, `"build_slug": "archived-slug", "app_slug": "archived-app", "stack_id": "archived-stack", "labels": {"team": "mobile"}, "success_steps"`, 1)
+	require.NoError(t, ioutil.WriteFile(archivedPth, []byte(archived), 0644))
+	result, err = sendPayloadFile(config, archivedPth, overrides, false)
+	require.NoError(t, err)
+	require.Equal(t, sendResultSent, result)
+	require.Equal(t, 4, len(received))
+	require.Equal(t, "archived-slug", received[3].BuildSlug)
+	require.Equal(t, "archived-slug", received[3].SubmissionID)
+	require.Equal(t, "archived-stack", received[3].StackID)
+	require.Equal(t, "app-slug", received[3].AppSlug)
+
+	result, err = sendPayloadFile(config, filepath.Join(tmpDir, "missing.json"), overrides, false)
+	require.Error(t, err)
+	require.Equal(t, sendResultFailed, result)
+}
+
+func TestApplyArchivedMetadata(t *testing.T) {
+	buildAnalytics := analytics.BuildAnalytics{}
+	buildAnalytics.StackID = "env-stack"
+	buildAnalytics.WorkflowName = "env-workflow"
+
+	require.NoError(t, applyArchivedMetadata(&buildAnalytics, map[string]json.RawMessage{
+		"workflow_name": json.RawMessage(`"primary"`),
+		"labels":        json.RawMessage(`{"team": "mobile"}`),
+		"workflow_id":   json.RawMessage(`"primary"`),
+	}))
+	require.Empty(t, buildAnalytics.StackID)
+	require.Equal(t, "primary", buildAnalytics.WorkflowName)
+	require.Equal(t, map[string]string{"team": "mobile"}, buildAnalytics.Labels)
+
+	require.Error(t, applyArchivedMetadata(&buildAnalytics, map[string]json.RawMessage{"build_slug": json.RawMessage(`1`)}))
+}
+
+func TestArchivedDeliveryConfig(t *testing.T) {
+	config := configs.ConfigModel{Webhooks: []configs.WebhookConfigModel{
+		{Name: "always"},
+		{Name: "status", Trigger: configs.WebhookTriggerOnStatusChange},
+		{Name: "failure", Trigger: configs.WebhookTriggerOnFailure},
+	}}
+
+	webhooks := archivedDeliveryConfig(config).Webhooks
+	require.Equal(t, 2, len(webhooks))
+	require.Equal(t, "always", webhooks[0].Name)
+	require.Equal(t, "failure", webhooks[1].Name)
+	require.Equal(t, 3, len(config.Webhooks))
+}
+
+func TestDeliverAnalyticsRetry(t *testing.T) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("deliver")
+	require.NoError(t, err)
+
+	configs.DataDir = tmpDir
+	defer func() {
+		configs.DataDir = ""
+	}()
+
+	var collectorRequests, webhookRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collectorRequests++
+		if collectorRequests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookRequests++
+	}))
+	defer webhookServer.Close()
+
+	config := configs.ConfigModel{
+		CloudEvents: &configs.CloudEventsConfigModel{URL: server.URL},
+		Webhooks:    []configs.WebhookConfigModel{{Name: "notify", URL: webhookServer.URL}},
+	}
+	buildAnalytics := analytics.BuildAnalytics{}
+	buildAnalytics.BuildSlug = "build-slug"
+
+	require.Error(t, deliverAnalytics(config, buildAnalytics, false))
+	require.Equal(t, 1, webhookRequests)
+
+	// the retry only sends the build to the collector
+	require.NoError(t, deliverAnalytics(config, buildAnalytics, false))
+	require.Equal(t, 2, collectorRequests)
+	require.Equal(t, 1, webhookRequests)
+
+	history, err := analytics.ReadHistory()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+
+	require.Equal(t, errAlreadyDelivered, deliverAnalytics(config, buildAnalytics, false))
+	require.Equal(t, 2, collectorRequests)
+}
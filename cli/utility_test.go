@@ -5,71 +5,110 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
 	"github.com/bitrise-io/bitrise/models"
 	"github.com/bitrise-io/go-utils/command/git"
 	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_checkFormatVersion(t *testing.T) {
-
 	tests := []struct {
 		name                        string
-		pluginFormatVersionStr      string
 		hostBitriseFormatVersionStr string
+		wantSupport                 formatSupport
+		wantMissingFields           []string
 		wantWarn                    string
 		wantErr                     bool
 	}{
 		{
-			name:                        "Simple test",
-			pluginFormatVersionStr:      "3",
-			hostBitriseFormatVersionStr: "3",
+			name:                        "Vendored format version",
+			hostBitriseFormatVersionStr: models.Version,
+			wantSupport:                 formatSupportFull,
 			wantWarn:                    "",
-			wantErr:                     false,
 		},
 		{
-			name:                        "Semver test",
-			pluginFormatVersionStr:      "1.4.0",
-			hostBitriseFormatVersionStr: "1.4.0",
+			name:                        "Semver format version",
+			hostBitriseFormatVersionStr: "11.0.0",
+			wantSupport:                 formatSupportFull,
 			wantWarn:                    "",
-			wantErr:                     false,
 		},
 		{
 			name:                        "Missing host Bitrise CLI format version",
-			pluginFormatVersionStr:      "3",
 			hostBitriseFormatVersionStr: "",
+			wantSupport:                 formatSupportDegraded,
 			wantWarn:                    "This analytics plugin version would need bitrise-cli version >= 1.6.0 to submit analytics",
-			wantErr:                     false,
 		},
 		{
-			name:                        "Outdated Host Bitrise format version",
-			pluginFormatVersionStr:      "3",
+			name:                        "Format version before plugins",
+			hostBitriseFormatVersionStr: "1.3.0",
+			wantSupport:                 formatSupportRefused,
+			wantWarn:                    "Outdated bitrise-cli, format version 1.3.0 is not supported by the analytics plugin, please update the bitrise-cli",
+		},
+		{
+			name:                        "Older format version",
 			hostBitriseFormatVersionStr: "1.4.0",
-			wantWarn:                    "Outdated bitrise-cli, used format version is lower then the analytics plugin's format version, please update the bitrise-cli",
-			wantErr:                     false,
+			wantSupport:                 formatSupportDegraded,
+			wantMissingFields:           []string{"step_inputs", "step start_time"},
+			wantWarn:                    "The analytics plugin partially supports bitrise-cli format version 1.4.0, these fields are not submitted: step_inputs, step start_time",
+		},
+		{
+			name:                        "Format version without upstream definition",
+			hostBitriseFormatVersionStr: "12",
+			wantSupport:                 formatSupportDegraded,
+			wantMissingFields:           []string{"fields added after format version 11"},
+			wantWarn:                    "The analytics plugin partially supports bitrise-cli format version 12, these fields are not submitted: fields added after format version 11",
 		},
 		{
-			name:                        "Outdated Plugin Format version",
-			pluginFormatVersionStr:      "3",
-			hostBitriseFormatVersionStr: "4",
-			wantWarn:                    "Outdated analytics plugin, used format version is lower then host bitrise-cli's format version, please update the plugin",
-			wantErr:                     false,
+			name:                        "Newer format version",
+			hostBitriseFormatVersionStr: "13",
+			wantSupport:                 formatSupportDegraded,
+			wantMissingFields:           []string{"fields added after format version 11"},
+			wantWarn:                    "The analytics plugin partially supports bitrise-cli format version 13, these fields are not submitted: fields added after format version 11",
+		},
+		{
+			name:                        "Invalid format version",
+			hostBitriseFormatVersionStr: "eleven",
+			wantErr:                     true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warn, err := checkFormatVersion(tt.pluginFormatVersionStr, tt.hostBitriseFormatVersionStr)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("checkFormatVersion() error = %v, wantErr %v", err, tt.wantErr)
+			compatibility, err := checkFormatVersion(tt.hostBitriseFormatVersionStr)
+			if tt.wantErr {
+				require.Error(t, err)
 				return
 			}
-			if warn != tt.wantWarn {
-				t.Errorf("checkFormatVersion() = %v, want %v", warn, tt.wantWarn)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantSupport, compatibility.support)
+			require.Equal(t, tt.wantMissingFields, compatibility.missingFields)
+			require.Equal(t, tt.wantWarn, compatibility.message(tt.hostBitriseFormatVersionStr))
+			if compatibility.support != formatSupportRefused {
+				require.NotEmpty(t, compatibility.decoder)
 			}
 		})
 	}
 }
 
+func Test_formatCompatibilities(t *testing.T) {
+	// the ranges are ordered, contiguous and open on both ends
+	require.Equal(t, "", formatCompatibilities[0].minVersion)
+	require.Equal(t, "", formatCompatibilities[len(formatCompatibilities)-1].maxVersion)
+	for i, compatibility := range formatCompatibilities {
+		if i > 0 {
+			require.Equal(t, formatCompatibilities[i-1].maxVersion, compatibility.minVersion)
+		}
+		if compatibility.support == formatSupportDegraded {
+			require.NotEmpty(t, compatibility.missingFields)
+		}
+		if compatibility.support != formatSupportRefused {
+			_, err := analytics.NewPayloadDecoder(compatibility.decoder)
+			require.NoError(t, err)
+		}
+	}
+}
+
 func TestFormat(t *testing.T) {
 	tmpDir, err := pathutil.NormalizedOSTempDirPath("analytics")
 	if err != nil {
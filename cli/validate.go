@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/urfave/cli"
+)
+
+var validateCommand = cli.Command{
+	Name:      "validate",
+	Usage:     "Check a build run results payload file for semantic problems, without sending it.",
+	ArgsUsage: "PAYLOAD_FILE",
+	Action: func(c *cli.Context) {
+		valid, err := validatePayload(c.Args().First())
+		if err != nil {
+			failf("Failed to validate payload: %s", err)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+	},
+}
+
+// validatePayload prints the problems of the payload file, or of the stdin payload if the path is empty,
+// it returns false if the payload has errors.
+func validatePayload(payloadPth string) (bool, error) {
+	var source PayloadSource = StdinPayloadSource{reader: os.Stdin}
+	if payloadPth != "" {
+		source = FilePayloadSource{pth: payloadPth}
+	}
+
+	payload, err := source.Payload()
+	if err != nil {
+		return false, fmt.Errorf("failed to read payload: %s", err)
+	}
+
+	problems := analytics.ValidatePayload(payload.BuildRunResultsModel)
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return true, nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tFIELD\tPROBLEM\tFIXABLE")
+	for _, problem := range problems {
+		fixable := "no"
+		if problem.Fixable {
+			fixable = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", problem.Severity, problem.Field, problem.Message, fixable)
+	}
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+
+	return !analytics.HasErrors(problems), nil
+}
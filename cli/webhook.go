@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bitrise-io/bitrise-plugins-analytics/analytics"
+	"github.com/bitrise-io/bitrise-plugins-analytics/configs"
+	"github.com/urfave/cli"
+)
+
+var renderWebhookCommand = cli.Command{
+	Name:      "render-webhook",
+	Usage:     "Render a webhook's request from a build run results payload without sending it.",
+	ArgsUsage: "WEBHOOK_NAME",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "payload",
+			Usage: "Build run results JSON or YAML file, read from stdin if not set.",
+		},
+	},
+	Action: func(c *cli.Context) {
+		if err := renderWebhook(c.Args().First(), c.String("payload")); err != nil {
+			failf("Failed to render webhook: %s", err)
+		}
+	},
+}
+
+func renderWebhook(name, payloadPth string) error {
+	if name == "" {
+		return fmt.Errorf("webhook name not provided")
+	}
+
+	config, err := configs.ReadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read analytics configuration: %s", err)
+	}
+
+	var webhook *configs.WebhookConfigModel
+	for i := range config.Webhooks {
+		if config.Webhooks[i].Name == name {
+			webhook = &config.Webhooks[i]
+		}
+	}
+	if webhook == nil {
+		return fmt.Errorf("webhook not found in the configuration: %s", name)
+	}
+
+	var source PayloadSource = StdinPayloadSource{reader: os.Stdin}
+	if payloadPth != "" {
+		source = FilePayloadSource{pth: payloadPth}
+	}
+
+	payload, err := source.Payload()
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %s", err)
+	}
+
+	// the build analytics is enriched as in the builds, for the templates to get the same fields
+	buildAnalytics := analytics.NewBuildAnalytics(payload)
+	analytics.Enrich(&buildAnalytics, config)
+
+	req, err := analytics.NewWebhookSink(*webhook).Render(buildAnalytics)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s\n", req.Method, req.URL)
+
+	keys := make([]string, 0, len(req.Headers))
+	for key := range req.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s: %s\n", key, req.Headers[key])
+	}
+
+	fmt.Println()
+	fmt.Println(req.Body)
+	return nil
+}
@@ -3,6 +3,7 @@ package configs
 import (
 	"errors"
 	"path"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
@@ -30,7 +31,54 @@ var (
 
 // ConfigModel ...
 type ConfigModel struct {
-	IsAnalyticsDisabled bool `yaml:"is_analytics_disabled"`
+	IsAnalyticsDisabled bool                    `yaml:"is_analytics_disabled"`
+	CloudEvents         *CloudEventsConfigModel `yaml:"cloudevents,omitempty"`
+	Labels              map[string]string       `yaml:"labels,omitempty"`
+	// ShareLabels sends the labels to the analytics collector too,
+	// they are only sent to the sinks, the hooks and the processors by default.
+	ShareLabels bool `yaml:"share_labels,omitempty"`
+	// Artifacts are the glob patterns of the artifact types collected from the deploy dir.
+	Artifacts map[string][]string `yaml:"artifacts,omitempty"`
+	// MaxPayloadSize is the maximum size of the stdin payload in bytes.
+	MaxPayloadSize int64 `yaml:"max_payload_size,omitempty"`
+	// ValidationPolicy decides what happens to the payloads with problems: send (default), fix or drop.
+	ValidationPolicy string `yaml:"validation_policy,omitempty"`
+
+	StatsD        *StatsDConfigModel        `yaml:"statsd,omitempty"`
+	InfluxDB      *InfluxDBConfigModel      `yaml:"influxdb,omitempty"`
+	Elasticsearch *ElasticsearchConfigModel `yaml:"elasticsearch,omitempty"`
+	Webhooks      []WebhookConfigModel      `yaml:"webhooks,omitempty"`
+	Syslog        *SyslogConfigModel        `yaml:"syslog,omitempty"`
+
+	Hooks            []HookConfigModel `yaml:"hooks,omitempty"`
+	HooksConcurrency int               `yaml:"hooks_concurrency,omitempty"`
+
+	Processors []ProcessorConfigModel `yaml:"processors,omitempty"`
+}
+
+// CloudEventsConfigModel wraps the events sent to the analytics collector in CloudEvents 1.0 envelopes.
+type CloudEventsConfigModel struct {
+	// Mode is either "structured" (default) or "binary".
+	Mode string `yaml:"mode,omitempty"`
+	// URL receives the events instead of the analytics collector if set.
+	URL string `yaml:"url,omitempty"`
+}
+
+// HookConfigModel is an external command receiving the build analytics JSON on its stdin.
+type HookConfigModel struct {
+	Name    string        `yaml:"name"`
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ProcessorConfigModel is an external command reading the build analytics JSON on its stdin
+// and writing the (possibly modified) build analytics JSON to its stdout.
+type ProcessorConfigModel struct {
+	Name    string        `yaml:"name"`
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
 }
 
 // NewConfigFromBytes ...
@@ -0,0 +1,74 @@
+package configs
+
+//=======================================
+// Sink models
+//=======================================
+
+// StatsDConfigModel configures the StatsD (DogStatsD) UDP sink.
+type StatsDConfigModel struct {
+	// Address of the StatsD agent, defaults to 127.0.0.1:8125.
+	Address string `yaml:"address,omitempty"`
+	// Prefix is prepended to every metric name, e.g. "bitrise.".
+	Prefix string `yaml:"prefix,omitempty"`
+	// SampleRate between 0 and 1, defaults to 1 (every metric is sent).
+	SampleRate float64 `yaml:"sample_rate,omitempty"`
+}
+
+// InfluxDBConfigModel configures the InfluxDB line protocol sink.
+// Lines are appended to File and/or written to the URL's /api/v2/write endpoint.
+type InfluxDBConfigModel struct {
+	File string `yaml:"file,omitempty"`
+
+	URL    string `yaml:"url,omitempty"`
+	Org    string `yaml:"org,omitempty"`
+	Bucket string `yaml:"bucket,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+}
+
+// ElasticsearchConfigModel configures the Elasticsearch/OpenSearch bulk indexing sink.
+// Index names may contain date math expressions, e.g. "bitrise-builds-{now/d}",
+// resolved against the build's start time.
+type ElasticsearchConfigModel struct {
+	URL        string `yaml:"url,omitempty"`
+	BuildIndex string `yaml:"build_index,omitempty"`
+	StepIndex  string `yaml:"step_index,omitempty"`
+
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	APIKey   string `yaml:"api_key,omitempty"`
+}
+
+// Webhook triggers
+const (
+	WebhookTriggerAlways         = "always"
+	WebhookTriggerOnFailure      = "on_failure"
+	WebhookTriggerOnStatusChange = "on_status_change"
+)
+
+// WebhookConfigModel configures a generic webhook sink.
+// The URL, the header values and the body template file are Go text/templates
+// rendered with the build analytics.
+type WebhookConfigModel struct {
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// BodyTemplate is the path of the body template file, relative paths are resolved against the plugin's data dir.
+	BodyTemplate string `yaml:"body_template,omitempty"`
+	// Trigger is one of always (default), on_failure or on_status_change.
+	Trigger string `yaml:"trigger,omitempty"`
+}
+
+// SyslogConfigModel configures the RFC 5424 syslog sink.
+type SyslogConfigModel struct {
+	// Network is one of unix (default), udp or tcp.
+	Network string `yaml:"network,omitempty"`
+	// Address is the socket path for unix (defaults to /dev/log), host:port otherwise.
+	Address string `yaml:"address,omitempty"`
+	// Facility is a facility keyword, like user (default), daemon or local0.
+	Facility string `yaml:"facility,omitempty"`
+	AppName  string `yaml:"app_name,omitempty"`
+	// EnterpriseID is the private enterprise number of the build's structured data IDs, like build@<enterprise_id>,
+	// without it only the registered origin element is sent.
+	EnterpriseID string `yaml:"enterprise_id,omitempty"`
+}
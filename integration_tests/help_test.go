@@ -20,12 +20,21 @@ VERSION:
    %s
 
 COMMANDS:
-   on       Turn sending anonimized usage information on.
-   off      Turn sending anonimized usage information off.
-   help, h  Shows a list of commands or help for one command
+   on              Turn sending anonimized usage information on.
+   off             Turn sending anonimized usage information off.
+   render-webhook  Render a webhook's request from a build run results payload without sending it.
+   history         List the builds recorded in the local history.
+   pipeline        Show a pipeline's timeline rebuilt from the builds recorded in the local history.
+   validate        Check a build run results payload file for semantic problems, without sending it.
+   send            Send archived build run results payload files, the builds already delivered are skipped.
+   import          Load a directory of archived build run results files into the local history, without sending them.
+   help, h         Shows a list of commands or help for one command
 
 GLOBAL OPTIONS:
    --loglevel value, -l value  Log level (options: debug, info, warn, error, fatal, panic). [$LOGLEVEL]
+   --source value              Payload source (options: stdin, env, file), detected if not set.
+   --payload-file value        Build run results payload file (JSON or YAML), read by the file source.
+   --force                     Send the build to the collector even if the ledger records it as delivered.
    --help, -h                  show help
    --version, -v               print the version`, version.VERSION)
 